@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type initAndroidCommand struct {
+	Dir   string `long:"dir" default:"android" description:"Directory to write the project to"`
+	AppID string `long:"app-id" description:"Application ID (package name) of the app (default: org.golang.<name>)"`
+	Force bool   `long:"force" description:"Overwrite existing files"`
+	Args  struct {
+		Lib string `positional-arg-name:"LIB" description:"File name of the Go library the app loads (default: lib<name>.so)"`
+	} `positional-args:"yes"`
+}
+
+// Used when no SDK platform is installed to take compileSdk from
+const defaultCompileSDK = 34
+
+func (c *initAndroidCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	name := javaIdentifier(filepath.Base(wd))
+	lib := c.Args.Lib
+	if lib == "" {
+		lib = "lib" + name + ".so"
+	}
+	if !strings.HasPrefix(lib, "lib") || !strings.HasSuffix(lib, ".so") {
+		return fmt.Errorf("%s can't be loaded with System.loadLibrary, name it lib<name>.so", lib)
+	}
+	if c.AppID == "" {
+		c.AppID = "org.golang." + name
+	}
+	compileSDK, err := newestPlatform(androidSDKFolder())
+	if err != nil {
+		compileSDK = defaultCompileSDK
+	}
+	if compileSDK < t.api {
+		compileSDK = t.api
+	}
+
+	java := filepath.Join("app", "src", "main", "java", filepath.FromSlash(strings.ReplaceAll(c.AppID, ".", "/")), "MainActivity.java")
+	files := []struct{ path, data string }{
+		{"settings.gradle", fmt.Sprintf(`// Generated by ndkenv init-android
+pluginManagement {
+    repositories {
+        google()
+        mavenCentral()
+        gradlePluginPortal()
+    }
+}
+dependencyResolutionManagement {
+    repositories {
+        google()
+        mavenCentral()
+    }
+}
+rootProject.name = "%s"
+include ":app"
+`, name)},
+		{"build.gradle", `// Generated by ndkenv init-android
+plugins {
+    id "com.android.application" version "8.5.2" apply false
+}
+`},
+		{filepath.Join("app", "build.gradle"), fmt.Sprintf(`// Generated by ndkenv init-android
+plugins {
+    id "com.android.application"
+}
+
+android {
+    namespace "%s"
+    compileSdk %d
+
+    defaultConfig {
+        applicationId "%s"
+        minSdk %d
+        targetSdk %d
+        versionCode 1
+        versionName "1.0"
+    }
+
+    // Go libraries are copied to src/main/jniLibs/<abi> by ndkenv --jnilibs
+    sourceSets {
+        main {
+            jniLibs.srcDirs = ["src/main/jniLibs"]
+        }
+    }
+}
+`, c.AppID, compileSDK, c.AppID, t.api, compileSDK)},
+		{filepath.Join("app", "src", "main", "AndroidManifest.xml"), `<?xml version="1.0" encoding="utf-8"?>
+<!-- Generated by ndkenv init-android -->
+<manifest xmlns:android="http://schemas.android.com/apk/res/android">
+    <application android:label="` + xmlEscaper.Replace(name) + `">
+        <activity android:name=".MainActivity" android:exported="true">
+            <intent-filter>
+                <action android:name="android.intent.action.MAIN" />
+                <category android:name="android.intent.category.LAUNCHER" />
+            </intent-filter>
+        </activity>
+    </application>
+</manifest>
+`},
+		{java, fmt.Sprintf(`// Generated by ndkenv init-android
+package %s;
+
+import android.app.Activity;
+import android.os.Bundle;
+import android.widget.TextView;
+
+public class MainActivity extends Activity {
+    static {
+        // Loads %s from jniLibs. Functions exported from Go as
+        // Java_%s_MainActivity_<name> can be declared here as native methods.
+        System.loadLibrary("%s");
+    }
+
+    @Override
+    protected void onCreate(Bundle savedInstanceState) {
+        super.onCreate(savedInstanceState);
+        TextView text = new TextView(this);
+        text.setText("Loaded %s");
+        setContentView(text);
+    }
+}
+`, c.AppID, lib, strings.ReplaceAll(c.AppID, ".", "_"), strings.TrimSuffix(strings.TrimPrefix(lib, "lib"), ".so"), lib)},
+	}
+	for _, f := range files {
+		path := filepath.Join(c.Dir, f.path)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err = writeNewFile(path, f.data, c.Force); err != nil {
+			return err
+		}
+		infof("Wrote %s", path)
+	}
+	fmt.Printf("Build the library into the project with:\n  ndkenv -a %s -s %d --jnilibs %s go build -buildmode=c-shared -o %s .\n",
+		opts.ABI, t.api, lib, lib)
+	fmt.Printf("Then open %s in Android Studio, or run gradle wrapper there to build from the command line\n", c.Dir)
+	return nil
+}
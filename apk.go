@@ -0,0 +1,283 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type apkCommand struct {
+	Output    string `short:"o" long:"output" value-name:"FILE" description:"Path to write the APK to (default: <name>.apk)"`
+	AppID     string `long:"app-id" description:"Application ID (package name) of the app (default: org.golang.<name>)"`
+	Label     string `long:"label" description:"Name of the app shown on the device (default: <name>)"`
+	TargetSDK int    `long:"target-sdk-version" description:"Target android SDK version (default: the newest installed platform)"`
+	Keystore  string `long:"keystore" value-name:"FILE" description:"Keystore to sign with, prompting for its password (default: the debug keystore)"`
+	Args      struct {
+		Package string `positional-arg-name:"PACKAGE" description:"Go package to build (default: .)"`
+	} `positional-args:"yes"`
+}
+
+// The debug keystore created by Android Studio, and its well-known credentials
+const (
+	debugKeystorePass  = "android"
+	debugKeystoreAlias = "androiddebugkey"
+)
+
+func (c *apkCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	if err = t.check(); err != nil {
+		return err
+	}
+	pkg := c.Args.Package
+	if pkg == "" {
+		pkg = "."
+	}
+	dir, err := filepath.Abs(pkg)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(dir)
+	if c.Output == "" {
+		c.Output = name + ".apk"
+	}
+	if c.AppID == "" {
+		c.AppID = "org.golang." + javaIdentifier(name)
+	}
+	if c.Label == "" {
+		c.Label = name
+	}
+
+	sdk := androidSDKFolder()
+	buildTools, err := newestSubdir(filepath.Join(sdk, "build-tools"))
+	if err != nil {
+		return fmt.Errorf("locating SDK build-tools: %w", err)
+	}
+	if c.TargetSDK == 0 {
+		if c.TargetSDK, err = newestPlatform(sdk); err != nil {
+			return fmt.Errorf("locating SDK platform: %w", err)
+		}
+	}
+	androidJar := filepath.Join(sdk, "platforms", fmt.Sprintf("android-%d", c.TargetSDK), "android.jar")
+	if !isFile(androidJar) {
+		return fmt.Errorf("%s not found, install platforms;android-%d with sdkmanager", androidJar, c.TargetSDK)
+	}
+
+	tmp, err := os.MkdirTemp("", "ndkenv-apk-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// NativeActivity loads libmain.so, which must export ANativeActivity_onCreate
+	lib := filepath.Join("lib", t.Name, "libmain.so")
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", filepath.Join(tmp, lib), pkg)
+	build.Env = commandEnv(t.env(inheritedGetenv))
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err = build.Run(); err != nil {
+		return fmt.Errorf("building %s: %w", pkg, err)
+	}
+
+	manifest := filepath.Join(tmp, "AndroidManifest.xml")
+	if err = os.WriteFile(manifest, []byte(apkManifest(c.AppID, c.Label)), 0644); err != nil {
+		return err
+	}
+	base := filepath.Join(tmp, "base.apk")
+	if err = runTool(filepath.Join(buildTools, "aapt2"), "link", "-o", base, "--manifest", manifest, "-I", androidJar,
+		"--min-sdk-version", strconv.Itoa(t.api), "--target-sdk-version", strconv.Itoa(c.TargetSDK)); err != nil {
+		return err
+	}
+	unaligned := filepath.Join(tmp, "unaligned.apk")
+	if err = addToZip(base, unaligned, tmp, []string{lib}); err != nil {
+		return err
+	}
+	aligned := filepath.Join(tmp, "aligned.apk")
+	if err = runTool(filepath.Join(buildTools, "zipalign"), "-f", "-p", "4", unaligned, aligned); err != nil {
+		return err
+	}
+
+	sign := []string{"sign", "--out", c.Output}
+	if c.Keystore != "" {
+		// apksigner prompts for the password
+		sign = append(sign, "--ks", c.Keystore)
+	} else {
+		keystore, err := debugKeystore()
+		if err != nil {
+			return err
+		}
+		sign = append(sign, "--ks", keystore, "--ks-key-alias", debugKeystoreAlias,
+			"--ks-pass", "pass:"+debugKeystorePass, "--key-pass", "pass:"+debugKeystorePass)
+	}
+	if err = runTool(filepath.Join(buildTools, "apksigner"), append(sign, aligned)...); err != nil {
+		return err
+	}
+	infof("Wrote %s, install it with: adb install -r %s", c.Output, c.Output)
+	return nil
+}
+
+var xmlEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;")
+
+func apkManifest(appID, label string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<!-- Generated by ndkenv apk -->
+<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="%s">
+    <application android:label="%s" android:hasCode="false" android:extractNativeLibs="true">
+        <activity android:name="android.app.NativeActivity"
+                  android:configChanges="orientation|keyboardHidden|screenSize"
+                  android:exported="true">
+            <meta-data android:name="android.app.lib_name" android:value="main" />
+            <intent-filter>
+                <action android:name="android.intent.action.MAIN" />
+                <category android:name="android.intent.category.LAUNCHER" />
+            </intent-filter>
+        </activity>
+    </application>
+</manifest>
+`, xmlEscaper.Replace(appID), xmlEscaper.Replace(label))
+}
+
+// javaIdentifier turns name into something that can be part of an application ID
+func javaIdentifier(name string) string {
+	id := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, name)
+	if id == "" || unicode.IsDigit(rune(id[0])) {
+		id = "_" + id
+	}
+	return id
+}
+
+// addToZip copies the zip at src to dst, adding files (relative to dir) to it
+func addToZip(src, dst, dir string, files []string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(f)
+	for _, entry := range r.File {
+		if err = w.Copy(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	for _, name := range files {
+		if err = addFileToZip(w, filepath.Join(dir, name), filepath.ToSlash(name)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func addFileToZip(w *zip.Writer, path, name string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name, header.Method = name, zip.Deflate
+	out, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// debugKeystore returns the path of the debug keystore, creating it the way
+// Android Studio would if it doesn't exist yet
+func debugKeystore() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(home, ".android", "debug.keystore")
+	if isFile(path) {
+		return path, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err = runTool("keytool", "-genkeypair", "-keystore", path, "-storepass", debugKeystorePass,
+		"-alias", debugKeystoreAlias, "-keypass", debugKeystorePass, "-keyalg", "RSA", "-validity", "10000",
+		"-dname", "CN=Android Debug,O=Android,C=US"); err != nil {
+		return "", fmt.Errorf("creating debug keystore (keytool comes with a JDK): %w", err)
+	}
+	return path, nil
+}
+
+// runTool runs an SDK tool, passing its output (and any password prompts) through
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", filepath.Base(name), err)
+	}
+	return nil
+}
+
+// newestSubdir returns the subdirectory of dir with the newest version as its name
+func newestSubdir(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	for _, entry := range entries {
+		if entry.IsDir() && (newest == "" || compareVersions(entry.Name(), newest) > 0) {
+			newest = entry.Name()
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("%s is empty", dir)
+	}
+	return filepath.Join(dir, newest), nil
+}
+
+// newestPlatform returns the newest API level with an installed SDK platform
+func newestPlatform(sdk string) (int, error) {
+	dir := filepath.Join(sdk, "platforms")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	newest := 0
+	for _, entry := range entries {
+		if api, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "android-")); err == nil && api > newest {
+			newest = api
+		}
+	}
+	if newest == 0 {
+		return 0, errors.New("no platforms installed in " + dir)
+	}
+	return newest, nil
+}
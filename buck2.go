@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type buck2Command struct{}
+
+func (c *buck2Command) Execute([]string) error {
+	fmt.Printf(`# Generated by ndkenv
+load("@prelude//toolchains:cxx.bzl", "system_cxx_toolchain")
+`)
+	return forEachABI(func(string) error {
+		t, err := resolve()
+		if err != nil {
+			return err
+		}
+		if err = t.check(); err != nil {
+			return err
+		}
+		nt := t.ndkConfig()
+		target := []string{"-target", fmt.Sprintf("%s%d", t.Target, t.api), "--sysroot=" + t.sysroot}
+		cflags := append(append(target, "-isystem", t.iSystem), t.flags.cflags()...)
+		ldflags := append(target[:len(target):len(target)], t.flags.LDFlags...)
+
+		fmt.Printf(`
+system_cxx_toolchain(
+    name = %s,
+    archiver = %s,
+    compiler = %s,
+    compiler_type = "clang",
+    cxx_compiler = %s,
+    linker = %s,
+    c_flags = %s,
+    cxx_flags = %s,
+    link_flags = %s,
+    visibility = ["PUBLIC"],
+)
+`, strconv.Quote("cxx_android_"+t.Name), strconv.Quote(nt.Tool("llvm-ar")), strconv.Quote(t.clang),
+			strconv.Quote(nt.Tool("clang++")), strconv.Quote(nt.Tool("clang++")),
+			starlarkList(cflags), starlarkList(cflags), starlarkList(ldflags))
+		return nil
+	})
+}
+
+func starlarkList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
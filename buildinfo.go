@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// buildVCSEnv returns GOFLAGS with -buildvcs added for the --buildvcs setting,
+// so that it applies to any go command run, even from scripts
+func buildVCSEnv(setting string) string {
+	value := map[string]string{"on": "true", "off": "false", "auto": "auto"}[setting]
+	return "GOFLAGS=" + strings.TrimSpace(inheritedGetenv("GOFLAGS")+" -buildvcs="+value)
+}
+
+// Go subcommands that link, so can be passed -ldflags
+var linkingGoCommands = []string{"build", "install", "run", "test"}
+
+// stampArgs adds -X flags to a go command's -ldflags, setting string variables
+// in package main to the ABI, API level and NDK version being built for. The
+// flags are also recorded in the binary's build info, unless built with -trimpath.
+func stampArgs(args []string, t target) ([]string, error) {
+	if len(args) < 2 || !isGoCommand(args) || !contains(linkingGoCommands, args[1]) {
+		return nil, errors.New("--stamp needs a go command that links, e.g. go build .")
+	}
+	version, err := ndkVersion(t.ndk)
+	if err != nil {
+		return nil, fmt.Errorf("reading NDK version: %w", err)
+	}
+	stamp := fmt.Sprintf("-X main.ndkenvABI=%s -X main.ndkenvAPI=%d -X main.ndkenvNDK=%s", t.Name, t.api, version)
+
+	// Only the last -ldflags counts, so add to that if there is one
+	args = append([]string(nil), args...)
+	for i := len(args) - 1; i >= 2; i-- {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[i], "-"), "=")
+		if name != "-ldflags" && name != "ldflags" {
+			continue
+		}
+		if hasValue {
+			args[i] = args[i][:len(args[i])-len(value)] + strings.TrimSpace(value+" "+stamp)
+		} else if i+1 < len(args) {
+			args[i+1] = strings.TrimSpace(args[i+1] + " " + stamp)
+		}
+		return args, nil
+	}
+	return append([]string{args[0], args[1], "-ldflags=" + stamp}, args[2:]...), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// compatIssue is a known problem with building for Android using a range of
+// Go and NDK versions. Empty fields match any version or ABI.
+type compatIssue struct {
+	goBefore  string // e.g. 1.13, for Go versions before 1.13
+	ndkFrom   int    // NDK major versions from this one...
+	ndkBefore int    // ...up to but excluding this one
+	abis      []string
+	problem   string
+	link      string
+}
+
+var compatIssues = []compatIssue{
+	{
+		goBefore: "1.13",
+		abis:     []string{"arm64-v8a"},
+		problem:  "executables crash on Android 10 and later, which needs their TLS segment aligned to 64 bytes",
+		link:     "https://go.dev/issue/29674",
+	},
+}
+
+// compatWarnings returns a warning for each known issue with building for t
+// with the given Go toolchain (e.g. go1.22.3) and NDK version
+func compatWarnings(goVersion, ndkVersion string, t target) []string {
+	goVersion = goVersionNumber(goVersion)
+	ndkMajor := 0
+	fmt.Sscanf(ndkVersion, "%d", &ndkMajor)
+
+	var warnings []string
+	for _, issue := range compatIssues {
+		switch {
+		case issue.goBefore != "" && (goVersion == "" || compareVersions(goVersion, issue.goBefore) >= 0),
+			issue.ndkFrom != 0 && ndkMajor < issue.ndkFrom,
+			issue.ndkBefore != 0 && ndkMajor >= issue.ndkBefore,
+			issue.abis != nil && !contains(issue.abis, t.Name):
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("Go %s with NDK %s for %s: %s (%s)",
+			goVersion, ndkVersion, t.Name, issue.problem, issue.link))
+	}
+	return warnings
+}
+
+// goVersionNumber returns just the version number of a Go version, e.g. 1.21
+// for go1.21rc2, or "" for development versions
+func goVersionNumber(version string) string {
+	if !strings.HasPrefix(version, "go1") {
+		return ""
+	}
+	version = strings.TrimPrefix(version, "go")
+	if i := strings.IndexFunc(version, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i >= 0 {
+		version = version[:i]
+	}
+	return version
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const configFileName = ".ndkenv.toml"
+
+// config is the per-project configuration read from .ndkenv.toml.
+// Values passed on the command line take precedence over values set here.
+type config struct {
+	ABI           string `toml:"abi"`
+	NDK           string `toml:"ndk"`
+	NDKArchive    string `toml:"ndk_archive"`
+	NDKVersion    string `toml:"ndk_version"`
+	MinSDKVersion int    `toml:"min_sdk_version"`
+
+	// Folders to look for an NDK in alongside the SDK's, as with
+	// --ndk-search-path
+	NDKSearchPaths []string `toml:"ndk_search_paths"`
+
+	// ABIs to run the command for in turn when --abi isn't given, as if each
+	// was passed to --abi, e.g. arm64-v8a:21
+	ABIs []string `toml:"abis"`
+
+	// Command run when ndkenv is given none, e.g. go build ./...
+	Command string `toml:"command"`
+
+	// Commands run as ndkenv <name>, keyed by name
+	Commands map[string]string `toml:"commands"`
+
+	buildSettings
+
+	// Named sets of settings selected with --profile, applied on top of the
+	// top-level settings
+	Profiles map[string]profile `toml:"profile"`
+}
+
+// buildSettings can be given at the top level of the config, or per profile
+type buildSettings struct {
+	// Flags shared by every ABI
+	flagSet
+
+	// Flags applied on top of the shared flags for a single ABI, keyed by ABI
+	Targets map[string]flagSet `toml:"target"`
+
+	// Flags applied on top of the shared and per-ABI flags when a condition holds
+	Conditional []conditionalFlags `toml:"conditional"`
+
+	// Steps run on the built library after the command succeeds, for each ABI
+	PostBuild *postBuild `toml:"post_build"`
+
+	// AARs containing Prefab packages to build against
+	Prefab []string `toml:"prefab"`
+
+	// Libraries from the NDK's sysroot to link against, e.g. log, as -l flags
+	Link []string `toml:"link"`
+
+	// Extra variables set alongside ndkenv's own, e.g. OPENSSL_DIR. Values
+	// may contain {abi}, {api} and {out}.
+	Env map[string]string `toml:"env"`
+
+	// Directory that builds write to, given to commands and paths as {out}.
+	// It may contain {abi} and {api}, and is created before the command runs.
+	OutDir string `toml:"out_dir"`
+}
+
+// merge returns s with other applied on top: flags, Prefab packages and
+// libraries to link are appended, per-ABI flags are merged ABI by ABI, conditional blocks are
+// appended, other's variables are added to s's, and other's post-build pipeline and out dir replace s's.
+func (s buildSettings) merge(other buildSettings) buildSettings {
+	merged := buildSettings{
+		flagSet:     s.flagSet.merge(other.flagSet),
+		Targets:     make(map[string]flagSet),
+		Env:         make(map[string]string),
+		Conditional: append(s.Conditional[:len(s.Conditional):len(s.Conditional)], other.Conditional...),
+		PostBuild:   s.PostBuild,
+		Prefab:      append(s.Prefab[:len(s.Prefab):len(s.Prefab)], other.Prefab...),
+		Link:        append(s.Link[:len(s.Link):len(s.Link)], other.Link...),
+		OutDir:      s.OutDir,
+	}
+	if other.PostBuild != nil {
+		merged.PostBuild = other.PostBuild
+	}
+	if other.OutDir != "" {
+		merged.OutDir = other.OutDir
+	}
+	for abi, flags := range s.Targets {
+		merged.Targets[abi] = flags
+	}
+	for name, value := range s.Env {
+		merged.Env[name] = value
+	}
+	for name, value := range other.Env {
+		merged.Env[name] = value
+	}
+	for abi, flags := range other.Targets {
+		merged.Targets[abi] = merged.Targets[abi].merge(flags)
+	}
+	return merged
+}
+
+// resolvePaths makes relative paths in s relative to dir
+func (s *buildSettings) resolvePaths(dir string) {
+	// {out} is already resolved
+	if s.PostBuild != nil && s.PostBuild.Artifact != "" && !filepath.IsAbs(s.PostBuild.Artifact) && !strings.HasPrefix(s.PostBuild.Artifact, "{out}") {
+		s.PostBuild.Artifact = filepath.Join(dir, s.PostBuild.Artifact)
+	}
+	for i, aar := range s.Prefab {
+		if !filepath.IsAbs(aar) {
+			s.Prefab[i] = filepath.Join(dir, aar)
+		}
+	}
+	if s.OutDir != "" && !filepath.IsAbs(s.OutDir) {
+		s.OutDir = filepath.Join(dir, s.OutDir)
+	}
+}
+
+// flagsFor returns the flags to use when building for abi at the given API level
+func (s buildSettings) flagsFor(abi string, api int) flagSet {
+	flags := s.flagSet.merge(s.Targets[abi])
+	for _, cond := range s.Conditional {
+		if cond.When.matches(abi, api) {
+			flags = flags.merge(cond.flagSet)
+		}
+	}
+	return flags
+}
+
+// profile is a named buildSettings, which may extend another profile
+type profile struct {
+	Extends string `toml:"extends"`
+	buildSettings
+}
+
+// settings returns the top-level settings with the named profile, and any
+// profiles it extends, applied on top. Returns just the top-level settings if name is "".
+func (c config) settings(name string) (buildSettings, error) {
+	// Walk up the chain of profiles from name, then apply them root-first
+	var chain []buildSettings
+	seen := make(map[string]bool)
+	for name != "" {
+		if seen[name] {
+			return buildSettings{}, fmt.Errorf("profile %s is part of a circular extends chain", name)
+		}
+		seen[name] = true
+		p, ok := c.Profiles[name]
+		if !ok {
+			return buildSettings{}, fmt.Errorf("unknown profile: %s", name)
+		}
+		chain = append(chain, p.buildSettings)
+		name = p.Extends
+	}
+	settings := c.buildSettings
+	for i := len(chain) - 1; i >= 0; i-- {
+		settings = settings.merge(chain[i])
+	}
+	return settings, nil
+}
+
+// conditionalFlags is a flagSet that only applies to targets matching When
+type conditionalFlags struct {
+	When condition `toml:"when"`
+	flagSet
+}
+
+// condition restricts conditionalFlags to an API level range and/or specific ABI.
+// Empty fields match everything.
+type condition struct {
+	API string `toml:"api"`
+	ABI string `toml:"abi"`
+
+	api apiConstraint
+}
+
+func (c condition) matches(abi string, api int) bool {
+	return (c.ABI == "" || c.ABI == abi) && c.api.matches(api)
+}
+
+// apiConstraint is a list of comparisons that must all hold, parsed from a
+// comma-separated string such as ">= 24, < 28"
+type apiConstraint []apiComparison
+
+type apiComparison struct {
+	op  string
+	api int
+}
+
+func parseAPIConstraint(s string) (apiConstraint, error) {
+	var constraint apiConstraint
+	if strings.TrimSpace(s) == "" {
+		return constraint, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var cmp apiComparison
+		// Longer operators first, so ">=" isn't parsed as ">"
+		for _, op := range []string{">=", "<=", "==", "!=", ">", "<", "="} {
+			if strings.HasPrefix(part, op) {
+				cmp.op = op
+				break
+			}
+		}
+		if cmp.op == "" {
+			return nil, fmt.Errorf("invalid api constraint %q: expected a comparison such as \">= 28\"", part)
+		}
+		api, err := strconv.Atoi(strings.TrimSpace(part[len(cmp.op):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid api constraint %q: expected an integer API level", part)
+		}
+		cmp.api = api
+		constraint = append(constraint, cmp)
+	}
+	return constraint, nil
+}
+
+func (c apiConstraint) matches(api int) bool {
+	for _, cmp := range c {
+		var ok bool
+		switch cmp.op {
+		case ">=":
+			ok = api >= cmp.api
+		case "<=":
+			ok = api <= cmp.api
+		case ">":
+			ok = api > cmp.api
+		case "<":
+			ok = api < cmp.api
+		case "==", "=":
+			ok = api == cmp.api
+		case "!=":
+			ok = api != cmp.api
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// flagSet is a group of compiler and linker flags
+type flagSet struct {
+	CFlags  []string `toml:"cflags"`
+	LDFlags []string `toml:"ldflags"`
+	Defines []string `toml:"defines"`
+
+	// Header directories of Prefab packages, passed as -isystem
+	ISystem []string `toml:"-"`
+}
+
+// merge returns f with other's flags appended
+func (f flagSet) merge(other flagSet) flagSet {
+	return flagSet{
+		CFlags:  append(f.CFlags[:len(f.CFlags):len(f.CFlags)], other.CFlags...),
+		LDFlags: append(f.LDFlags[:len(f.LDFlags):len(f.LDFlags)], other.LDFlags...),
+		Defines: append(f.Defines[:len(f.Defines):len(f.Defines)], other.Defines...),
+		ISystem: append(f.ISystem[:len(f.ISystem):len(f.ISystem)], other.ISystem...),
+	}
+}
+
+// cflags returns CFlags followed by cppflags
+func (f flagSet) cflags() []string {
+	return append(f.CFlags[:len(f.CFlags):len(f.CFlags)], f.cppflags()...)
+}
+
+// cppflags returns ISystem as -isystem flags, followed by Defines as -D flags
+func (f flagSet) cppflags() []string {
+	var flags []string
+	for _, dir := range f.ISystem {
+		flags = append(flags, "-isystem", dir)
+	}
+	for _, define := range f.Defines {
+		flags = append(flags, "-D"+define)
+	}
+	return flags
+}
+
+// findConfig looks for a config file in dir and each of its parents.
+// Returns "" if there isn't one.
+func findConfig(dir string) string {
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// expandCommand replaces the name of a command defined in the project config
+// at the start of args with the command, keeping any arguments after it
+func expandCommand(args []string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return args, nil
+	}
+	path := findConfig(wd)
+	if path == "" {
+		return args, nil
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	command, ok := cfg.Commands[args[0]]
+	if !ok {
+		return args, nil
+	}
+	// Already checked when the config was validated
+	expanded, _ := splitArgs(command)
+	return append(expanded, args[1:]...), nil
+}
+
+func loadConfig(path string) (config, error) {
+	var cfg config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	src := newConfigSource(path, data)
+	md, err := toml.Decode(string(data), &cfg)
+	if err != nil {
+		return cfg, src.decodeError(err)
+	}
+	if err = expandAll(reflect.ValueOf(&cfg).Elem(), src, nil, 0); err != nil {
+		return cfg, err
+	}
+	if errs := cfg.validate(src, md); len(errs) > 0 {
+		return cfg, errs
+	}
+	// Relative NDK paths are relative to the config file, not the working dir
+	if cfg.NDK != "" && !filepath.IsAbs(cfg.NDK) {
+		cfg.NDK = filepath.Join(filepath.Dir(path), cfg.NDK)
+	}
+	if cfg.NDKArchive != "" && !filepath.IsAbs(cfg.NDKArchive) {
+		cfg.NDKArchive = filepath.Join(filepath.Dir(path), cfg.NDKArchive)
+	}
+	for i, dir := range cfg.NDKSearchPaths {
+		if !filepath.IsAbs(dir) {
+			cfg.NDKSearchPaths[i] = filepath.Join(filepath.Dir(path), dir)
+		}
+	}
+	cfg.buildSettings.resolvePaths(filepath.Dir(path))
+	// Profiles are map values, so each is resolved as a copy and written back
+	for name, p := range cfg.Profiles {
+		p.resolvePaths(filepath.Dir(path))
+		cfg.Profiles[name] = p
+	}
+	return cfg, nil
+}
+
+// expandAll interpolates environment variables into every string reachable from v.
+// key and nth locate v in src, for error reporting.
+func expandAll(v reflect.Value, src configSource, key toml.Key, nth int) error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := expandVars(v.String())
+		if err != nil {
+			return src.errorf(key, nth, "%s: %s", key, err)
+		}
+		v.SetString(s)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return expandAll(v.Elem(), src, key, nth)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			fieldKey := key
+			if !f.Anonymous {
+				// Skip unexported fields, which aren't read from the file
+				if f.PkgPath != "" {
+					continue
+				}
+				fieldKey = appendKey(key, tomlName(f))
+			}
+			if err := expandAll(v.Field(i), src, fieldKey, nth); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			// Elements of arrays of tables are told apart by their position in the file
+			elemNth := nth
+			if v.Type().Elem().Kind() == reflect.Struct {
+				elemNth = i
+			}
+			if err := expandAll(v.Index(i), src, key, elemNth); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Map values aren't addressable, so expand a copy and store it back
+		for _, k := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+			if err := expandAll(elem, src, appendKey(key, k.String()), nth); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, elem)
+		}
+	}
+	return nil
+}
+
+// expandVars replaces ${VAR} and ${VAR:-default} with values from the environment.
+// Unlike the shell, referencing an unset variable without a default is an error,
+// so that a typo doesn't silently produce an empty path. Bare $VAR is left alone,
+// as it commonly appears in flags such as -Wl,-rpath,$ORIGIN. Use $${ for a literal ${.
+func expandVars(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		b.WriteString(s[:i])
+		expr := s[i+2 : i+end]
+		name, def, hasDef := strings.Cut(expr, ":-")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case ok && value != "":
+			b.WriteString(value)
+		case hasDef:
+			b.WriteString(def)
+		case ok:
+			// Set but empty, with no default to fall back on
+		default:
+			return "", fmt.Errorf("environment variable %s is not set (use ${%s:-} to allow this)", name, name)
+		}
+		s = s[i+end+1:]
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type initDevcontainerCommand struct {
+	Force bool `long:"force" description:"Overwrite existing files"`
+}
+
+// devcontainerFeature is a devcontainer-feature.json
+type devcontainerFeature struct {
+	ID            string            `json:"id"`
+	Version       string            `json:"version"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	ContainerEnv  map[string]string `json:"containerEnv"`
+	InstallsAfter []string          `json:"installsAfter"`
+}
+
+func (c *initDevcontainerCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	version, err := ndkVersion(t.ndk)
+	if err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+	release, err := ndkReleaseName(version)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	feature := devcontainerFeature{
+		ID:      "ndkenv",
+		Version: "1.0.0",
+		Name:    "Android NDK (ndkenv)",
+		Description: fmt.Sprintf("Installs NDK %s and ndkenv, and sets up the environment for building for %s with min SDK version %d",
+			version, opts.ABI, t.api),
+		ContainerEnv:  map[string]string{"ANDROID_NDK_HOME": dockerNDK},
+		InstallsAfter: []string{"ghcr.io/devcontainers/features/go"},
+	}
+	for _, kv := range t.env(noEnv) {
+		key, value, _ := strings.Cut(kv, "=")
+		if value == "" {
+			continue
+		}
+		feature.ContainerEnv[key] = t.relocate(value, dockerNDK, "linux-x86_64")
+	}
+	featureJSON, err := json.MarshalIndent(feature, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	install := fmt.Sprintf(`#!/bin/sh
+# Generated by ndkenv init-devcontainer
+set -e
+
+apt-get update
+apt-get install -y --no-install-recommends ca-certificates curl unzip
+rm -rf /var/lib/apt/lists/*
+
+# NDK %s
+curl -fsSL -o /tmp/ndk.zip https://dl.google.com/android/repository/android-ndk-%s-linux.zip
+unzip -q /tmp/ndk.zip -d /opt
+mv /opt/android-ndk-%s %s
+rm /tmp/ndk.zip
+
+# Go is installed by the go feature (or image), which this feature installs after
+PATH="$PATH:/usr/local/go/bin" GOBIN=/usr/local/bin go install github.com/iamcalledrob/ndkenv@%s
+`, version, release, release, dockerNDK, ndkenvVersion())
+
+	dir := filepath.Join(wd, ".devcontainer", "ndkenv")
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err = writeNewFile(filepath.Join(dir, "devcontainer-feature.json"), string(featureJSON)+"\n", c.Force); err != nil {
+		return err
+	}
+	if err = writeNewFile(filepath.Join(dir, "install.sh"), install, c.Force); err != nil {
+		return err
+	}
+	if err = os.Chmod(filepath.Join(dir, "install.sh"), 0755); err != nil {
+		return err
+	}
+	infof("Wrote %s", filepath.Join(".devcontainer", "ndkenv"))
+
+	// Reference the feature from a new devcontainer.json, or explain how to
+	// add it to an existing one, which may have comments that'd be lost on rewriting
+	configPath := filepath.Join(wd, ".devcontainer", "devcontainer.json")
+	if _, err = os.Stat(configPath); err == nil {
+		fmt.Printf("Add the feature to %s:\n  \"features\": { \"./ndkenv\": {} }\n", configPath)
+		return nil
+	}
+	config := `{
+  "name": "Go for Android",
+  "image": "mcr.microsoft.com/devcontainers/go",
+  "features": {
+    "./ndkenv": {}
+  }
+}
+`
+	if err = writeNewFile(configPath, config, false); err != nil {
+		return err
+	}
+	infof("Wrote %s", filepath.Join(".devcontainer", "devcontainer.json"))
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type direnvCommand struct {
+	Print bool `long:"print" description:"Print the snippet rather than writing it to .envrc"`
+}
+
+// Lines around the part of .envrc that ndkenv direnv writes, so it can be
+// replaced when run again without touching the rest of the file
+const (
+	envrcStart = "# >>> ndkenv >>>"
+	envrcEnd   = "# <<< ndkenv <<<"
+)
+
+func (c *direnvCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	if err = t.check(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n# Generated by ndkenv direnv for %s with min SDK version %d, run it again to update\n", envrcStart, t.Name, t.api)
+	// Existing flags of whoever generated it shouldn't be baked in
+	for _, kv := range t.env(noEnv) {
+		name, value, _ := strings.Cut(kv, "=")
+		fmt.Fprintln(&b, shellExport("bash", name, value))
+	}
+	b.WriteString(envrcEnd + "\n")
+	if c.Print {
+		fmt.Print(b.String())
+		return nil
+	}
+
+	envrc, err := os.ReadFile(".envrc")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existing := string(envrc)
+	start := strings.Index(existing, envrcStart)
+	end := strings.Index(existing, envrcEnd)
+	switch {
+	case start >= 0 && end > start:
+		existing = existing[:start] + b.String() + strings.TrimPrefix(existing[end+len(envrcEnd):], "\n")
+	case existing != "" && !strings.HasSuffix(existing, "\n"):
+		existing += "\n" + b.String()
+	default:
+		existing += b.String()
+	}
+	if err = os.WriteFile(".envrc", []byte(existing), 0644); err != nil {
+		return err
+	}
+	infof("Wrote .envrc, run direnv allow to load it")
+	return nil
+}
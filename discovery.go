@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// explain reports a step of locating the NDK, with --explain-discovery (or
+// --debug), so that failures to find one can be debugged
+func explain(format string, args ...interface{}) {
+	if opts.ExplainNDK || maxLevel() >= levelDebug {
+		writeLog(levelDebug, "Discovery: ", fmt.Sprintf(format, args...))
+	}
+}
+
+// whyNotMatched explains why findNDK skipped NDK version v when looking for
+// the requested version
+func whyNotMatched(v, requested string) string {
+	if requested != "" && !matchVersion(requested, v) {
+		return "it doesn't match --ndk-version " + requested
+	}
+	return fmt.Sprintf("it's a pre-release, which --channel %s excludes", opts.Channel)
+}
+
+// findNDKCached is findNDK, memoized in the cache for as long as the folders it
+// would scan are unchanged, as builds driven by make may run ndkenv dozens of
+// times. Installing or removing an NDK changes the mtime of its folder.
+func findNDKCached(version string, searchPaths []string) (string, error) {
+	// Explaining discovery means doing it
+	if opts.NoCache || opts.ExplainNDK {
+		return findNDK(version, searchPaths)
+	}
+	cache, err := ndkCacheDir()
+	if err != nil {
+		return findNDK(version, searchPaths)
+	}
+	// Everything else findNDK's result depends on
+	folders := append([]string{filepath.Join(androidSDKFolder(), "ndk")}, searchPaths...)
+	query := []string{version, opts.Channel, opts.NDKPolicy, localProperty("ndk.dir")}
+	for _, name := range ndkEnvVars {
+		query = append(query, os.Getenv(name))
+	}
+	query = append(query, folders...)
+	queryHash := sha256.Sum256([]byte(strings.Join(query, "\x00")))
+	memo := filepath.Join(cache, "discovery", hex.EncodeToString(queryHash[:]))
+
+	stamp := folderStamp(folders)
+	if data, err := os.ReadFile(memo); err == nil && strings.HasPrefix(string(data), stamp) {
+		// The NDK may have been replaced in place
+		ndk := strings.TrimPrefix(string(data), stamp)
+		if v, err := ndkVersion(ndk); err == nil && (version == "" || matchVersion(version, v)) && inChannel(v, version) {
+			verbosef("Using NDK %s, found by an earlier run (--no-cache to look again)", v)
+			return ndk, nil
+		}
+	}
+
+	ndk, err := findNDK(version, searchPaths)
+	if err != nil {
+		return "", err
+	}
+	// Failing to memoize only costs time on the next run
+	if err = os.MkdirAll(filepath.Dir(memo), 0755); err == nil {
+		_ = os.WriteFile(memo, []byte(stamp+ndk), 0644)
+	}
+	return ndk, nil
+}
+
+// folderStamp returns the mtimes of folders, or 0 for those that don't exist
+func folderStamp(folders []string) string {
+	var b strings.Builder
+	for _, dir := range folders {
+		var mtime int64
+		if info, err := os.Stat(dir); err == nil {
+			mtime = info.ModTime().UnixNano()
+		}
+		fmt.Fprintf(&b, "%d ", mtime)
+	}
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// distArchive collects the library built for each ABI, to be written as a
+// single archive once every ABI has been built
+type distArchive struct {
+	path string
+	libs []distLib
+}
+
+type distLib struct {
+	t      target
+	lib    string
+	header string // "" if there isn't one
+}
+
+// distMetadata is written to metadata.json in the archive
+type distMetadata struct {
+	Name       string        `json:"name"`
+	NDKVersion string        `json:"ndk_version"`
+	CreatedBy  string        `json:"created_by"`
+	ABIs       []distABIInfo `json:"abis"`
+}
+
+type distABIInfo struct {
+	ABI           string `json:"abi"`
+	MinSDKVersion int    `json:"min_sdk_version"`
+	Library       string `json:"library"`
+	Header        string `json:"header,omitempty"`
+}
+
+// builtArtifact returns the path of the library built for t by args, from the
+// post_build artifact or the -o flag of go build
+func builtArtifact(t target, args []string) (string, error) {
+	if t.postBuild != nil && t.postBuild.Artifact != "" {
+		return t.expand(t.postBuild.Artifact), nil
+	}
+	if isGoCommand(args) {
+		for i, arg := range args {
+			if arg == "-o" && i+1 < len(args) {
+				return args[i+1], nil
+			}
+			if strings.HasPrefix(arg, "-o=") {
+				return strings.TrimPrefix(arg, "-o="), nil
+			}
+		}
+	}
+	return "", errors.New("--dist and --if-changed need to know where the library is built, from go build -o or post_build.artifact")
+}
+
+// add records the library built for t. go build -buildmode=c-shared writes a
+// header alongside the library, which is included too if it exists.
+func (d *distArchive) add(t target, lib string) error {
+	if !isFile(lib) {
+		return fmt.Errorf("%s wasn't built", lib)
+	}
+	header := strings.TrimSuffix(lib, filepath.Ext(lib)) + ".h"
+	if !isFile(header) {
+		header = ""
+	}
+	d.libs = append(d.libs, distLib{t: t, lib: lib, header: header})
+	return nil
+}
+
+// write writes the archive, with the library and header for each ABI in lib/<abi>
+// and include/<abi> respectively, as headers differ between 32 and 64-bit ABIs
+func (d *distArchive) write() error {
+	if len(d.libs) == 0 {
+		return errors.New("nothing was built")
+	}
+	version, err := ndkVersion(d.libs[0].t.ndk)
+	if err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+	name := filepath.Base(d.libs[0].lib)
+	meta := distMetadata{
+		Name:       strings.TrimSuffix(name, filepath.Ext(name)),
+		NDKVersion: version,
+		CreatedBy:  createdBy(),
+	}
+
+	f, err := os.Create(d.path)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(f)
+	if err = d.writeTo(w, meta); err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (d *distArchive) writeTo(w *zip.Writer, meta distMetadata) error {
+	for _, l := range d.libs {
+		info := distABIInfo{
+			ABI:           l.t.Name,
+			MinSDKVersion: l.t.api,
+			Library:       path.Join("lib", l.t.Name, filepath.Base(l.lib)),
+		}
+		if err := addFileToZip(w, l.lib, info.Library); err != nil {
+			return err
+		}
+		if l.header != "" {
+			info.Header = path.Join("include", l.t.Name, filepath.Base(l.header))
+			if err := addFileToZip(w, l.header, info.Header); err != nil {
+				return err
+			}
+		}
+		meta.ABIs = append(meta.ABIs, info)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := w.CreateHeader(&zip.FileHeader{Name: "metadata.json", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+// createdBy returns the name and version of ndkenv, for recording in files it writes
+func createdBy() string {
+	// Local builds don't have a version
+	if v := ndkenvVersion(); v != "latest" {
+		return "ndkenv " + v
+	}
+	return "ndkenv"
+}
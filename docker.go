@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+type initDockerCommand struct {
+	Compose bool `long:"compose" description:"Also write a docker-compose.yml that mounts the project and caches Go downloads between builds"`
+	Force   bool `long:"force" description:"Overwrite existing files"`
+	Args    struct {
+		Command []string `positional-arg-name:"COMMAND" description:"Command to build with (default: go build ./...)"`
+	} `positional-args:"yes"`
+}
+
+// Where the NDK is installed in the image
+const dockerNDK = "/opt/android-ndk"
+
+func (c *initDockerCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	version, err := ndkVersion(t.ndk)
+	if err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+	release, err := ndkReleaseName(version)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	goVersion, err := moduleGoVersion(wd)
+	if err != nil {
+		return err
+	}
+
+	// The image always builds with the options in effect now, even if the
+	// project config changes later, as the point is a reproducible build
+	invocation := []string{"ndkenv", "--ndk", dockerNDK, "-a", opts.ABI, "-s", strconv.Itoa(t.api)}
+	if opts.Profile != "" {
+		invocation = append(invocation, "-p", opts.Profile)
+	}
+	command := c.Args.Command
+	if len(command) == 0 {
+		command = []string{"go", "build", "./..."}
+	}
+	invocation = append(invocation, command...)
+	quoted := make([]string, len(invocation))
+	for i, arg := range invocation {
+		quoted[i] = strconv.Quote(arg)
+	}
+
+	dockerfile := fmt.Sprintf(`# Generated by ndkenv init-docker
+# The NDK only provides x86_64 toolchains for Linux
+FROM --platform=linux/amd64 golang:%s
+
+RUN apt-get update && apt-get install -y --no-install-recommends unzip && rm -rf /var/lib/apt/lists/*
+
+# NDK %s
+RUN curl -fsSL -o /tmp/ndk.zip https://dl.google.com/android/repository/android-ndk-%s-linux.zip && \
+    unzip -q /tmp/ndk.zip -d /opt && \
+    mv /opt/android-ndk-%s %s && \
+    rm /tmp/ndk.zip
+
+RUN go install github.com/iamcalledrob/ndkenv@%s
+
+WORKDIR /src
+COPY . .
+CMD [%s]
+`, goVersion, version, release, release, dockerNDK, ndkenvVersion(), strings.Join(quoted, ", "))
+
+	files := map[string]string{"Dockerfile": dockerfile}
+	names := []string{"Dockerfile"}
+	if c.Compose {
+		files["docker-compose.yml"] = `# Generated by ndkenv init-docker
+services:
+  build:
+    build: .
+    volumes:
+      - .:/src
+      - go-build-cache:/root/.cache/go-build
+      - go-mod-cache:/go/pkg/mod
+
+volumes:
+  go-build-cache:
+  go-mod-cache:
+`
+		names = append(names, "docker-compose.yml")
+	}
+	for _, name := range names {
+		if err = writeNewFile(filepath.Join(wd, name), files[name], c.Force); err != nil {
+			return err
+		}
+		infof("Wrote %s", name)
+	}
+	return nil
+}
+
+// writeNewFile writes data to path, failing if the file exists unless overwrite is set
+func writeNewFile(path string, data string, overwrite bool) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flag |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flag, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists, pass --force to overwrite it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ndkReleaseName returns the release name used for downloads of an NDK version,
+// e.g. r26b for 26.1.10909125. The minor version counts the letter revisions.
+func ndkReleaseName(version string) (string, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("can't work out the release name of NDK %s", version)
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || minor > 25 {
+		return "", fmt.Errorf("can't work out the release name of NDK %s", version)
+	}
+	name := fmt.Sprintf("r%d", major)
+	if minor > 0 {
+		name += string(rune('a' + minor))
+	}
+	// e.g. r27-beta1 for 27.0.11718014-beta1
+	if pre := preRelease(version); pre != "" {
+		name += "-" + pre
+	}
+	return name, nil
+}
+
+var goDirective = regexp.MustCompile(`(?m)^(go|toolchain)\s+(?:go)?(\S+)`)
+
+// moduleGoVersion returns the Go version of the module in dir (or a parent),
+// preferring its toolchain directive, falling back to the installed Go version
+func moduleGoVersion(dir string) (string, error) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if data, err := os.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			var version string
+			for _, m := range goDirective.FindAllStringSubmatch(string(data), -1) {
+				if version == "" || m[1] == "toolchain" {
+					version = m[2]
+				}
+			}
+			if version != "" {
+				return version, nil
+			}
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return "", fmt.Errorf("finding Go version: %w", err)
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "go"), nil
+}
+
+// ndkenvVersion returns the version of ndkenv that's running, for reinstalling it
+// elsewhere. Local builds fall back to latest, as they can't be installed by version.
+func ndkenvVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" &&
+		info.Main.Version != "(devel)" && !strings.Contains(info.Main.Version, "+") {
+		return info.Main.Version
+	}
+	return "latest"
+}
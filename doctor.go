@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+type doctorCommand struct{}
+
+// doctor prints the result of each check it runs, counting those that fail
+type doctor struct {
+	failed int
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Printf("ok    %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(err error, fix string) {
+	d.failed++
+	// Errors may span lines, e.g. when listing the NDKs found
+	fmt.Printf("FAIL  %s\n", strings.ReplaceAll(err.Error(), "\n", "\n      "))
+	if fix != "" {
+		fmt.Printf("      Fix: %s\n", fix)
+	}
+}
+
+// Execute checks each step from locating the NDK to building with cgo for
+// each ABI, or every ABI if none are given
+func (c *doctorCommand) Execute([]string) error {
+	d := &doctor{}
+	projectCfg, projectLock, err := loadProject()
+	if err != nil {
+		d.fail(err, "fix the problems with .ndkenv.toml listed above")
+		return d.err()
+	}
+	if err = locateNDK(projectCfg, projectLock); err != nil {
+		d.fail(err, "install an NDK with ndkenv install-ndk, or pass --ndk with the path of one")
+		return d.err()
+	}
+	if version, err := ndkVersion(opts.NDK); err != nil {
+		d.fail(fmt.Errorf("reading the version of the NDK at %s: %w", opts.NDK, err), "pass --ndk with the path of an NDK, containing source.properties")
+	} else {
+		d.ok("NDK %s at %s", version, opts.NDK)
+	}
+
+	if len(abiSpecs()) == 0 && projectCfg.ABI == "" {
+		opts.ABIs = []string{"all"}
+	}
+	if opts.MinSDKVersion == 0 && projectCfg.MinSDKVersion == 0 {
+		opts.MinSDKVersion = autoSDK
+	}
+	err = forEachABI(func(spec string) error {
+		t, err := resolve()
+		if err != nil {
+			d.fail(err, "")
+			return nil
+		}
+		d.checkTarget(t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.err()
+}
+
+func (d *doctor) err() error {
+	switch d.failed {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("1 check failed")
+	default:
+		return fmt.Errorf("%d checks failed", d.failed)
+	}
+}
+
+func (d *doctor) checkTarget(t target) {
+	if err := t.check(); err != nil {
+		d.fail(err, "reinstall the NDK, or use another with --ndk or --ndk-version")
+		return
+	}
+	out, err := exec.Command(t.clang, "--version").Output()
+	if err != nil {
+		d.fail(fmt.Errorf("running %s: %w", t.clang, err), "check the NDK's toolchain is for this host, or pass --host-tag")
+		return
+	}
+	version := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+	d.ok("%s at API level %d with %s", t.Name, t.api, version)
+
+	// As for a build
+	newEnv := t.env(inheritedGetenv)
+	if opts.RespectEnv != "" {
+		newEnv = respectEnv(newEnv, strings.Split(opts.RespectEnv, ","))
+	}
+	if err := checkConflicts(newEnv); err != nil {
+		d.fail(err, "unset them, or leave out --strict to just be warned")
+		return
+	}
+	env := commandEnv(newEnv)
+	tc, err := selectGoToolchain(t, env)
+	if err != nil {
+		d.fail(err, "install a newer Go, or set GOTOOLCHAIN to one supporting it")
+		return
+	}
+	cgo, err := goOutput(env, "env", "CGO_ENABLED")
+	if err != nil {
+		d.fail(fmt.Errorf("running go env: %w", err), "")
+		return
+	}
+	if strings.TrimSpace(cgo) != "1" {
+		d.fail(fmt.Errorf("cgo is disabled for %s", t.Name), "leave CGO_ENABLED out of --respect-env")
+		return
+	}
+	d.ok("%s builds android/%s with cgo", tc.version, t.GOARCH)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Escapes a string for use inside a double-quoted dotenv value
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`)
+
+// writeEnvFiles writes the environment for each ABI to the --write-env file,
+// as KEY=VALUE lines that docker compose's env_file and dotenv loaders read
+func writeEnvFiles() error {
+	return forEachABI(func(string) error {
+		if opts.ABI == hostABI {
+			return nil // Nothing to set
+		}
+		t, err := resolve()
+		if err != nil {
+			return err
+		}
+		if err = t.check(); err != nil {
+			return err
+		}
+		var b strings.Builder
+		b.WriteString("# Generated by ndkenv\n")
+		// Loaders of the file may not see the same environment, so nothing is inherited
+		for _, kv := range t.env(noEnv) {
+			name, value, _ := strings.Cut(kv, "=")
+			// Single quotes are taken literally, where loaders support them at all
+			if strings.Contains(value, "'") {
+				fmt.Fprintf(&b, "%s=\"%s\"\n", name, dotenvEscaper.Replace(value))
+			} else {
+				fmt.Fprintf(&b, "%s='%s'\n", name, value)
+			}
+		}
+		path := t.expand(opts.WriteEnv)
+		if err = os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+			return err
+		}
+		infof("Wrote %s", path)
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type envCommand struct {
+	Format string `long:"format" choice:"shell" choice:"json" default:"shell" description:"Print shell commands, or a JSON object with the variables and the NDK, clang and sysroot they refer to"`
+	Shell  string `long:"shell" choice:"bash" choice:"zsh" choice:"fish" choice:"powershell" choice:"cmd" default:"bash" description:"Shell to print the variables for"`
+	GitHub bool   `long:"github" description:"Append the variables to $GITHUB_ENV, and the toolchain's bin directory to $GITHUB_PATH, for later steps of a GitHub Actions job, rather than printing them"`
+}
+
+// Quote values so that the shell takes them literally
+var (
+	posixQuoter      = strings.NewReplacer(`'`, `'\''`)
+	fishQuoter       = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	powershellQuoter = strings.NewReplacer(`'`, `''`)
+)
+
+// shellExport returns the statement that sets name to value in shell
+func shellExport(shell, name, value string) string {
+	switch shell {
+	case "fish":
+		return fmt.Sprintf("set -gx %s '%s'", name, fishQuoter.Replace(value))
+	case "powershell":
+		return fmt.Sprintf("$env:%s = '%s'", name, powershellQuoter.Replace(value))
+	case "cmd":
+		return fmt.Sprintf(`set "%s=%s"`, name, value)
+	default:
+		return fmt.Sprintf("export %s='%s'", name, posixQuoter.Replace(value))
+	}
+}
+
+func (c *envCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	if err = t.check(); err != nil {
+		return err
+	}
+	env := t.env(os.Getenv)
+	if c.GitHub {
+		return writeGitHubEnv(t, env)
+	}
+	if c.Format == "json" {
+		resp, err := newEnvResponse(t, env)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(resp, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		fmt.Println(shellExport(c.Shell, name, value))
+	}
+	return nil
+}
+
+// writeGitHubEnv appends env to the files that GitHub Actions reads the
+// environment of a job's later steps from
+// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#environment-files
+func writeGitHubEnv(t target, env []string) error {
+	path := os.Getenv("GITHUB_ENV")
+	if path == "" {
+		return errors.New("--github needs $GITHUB_ENV, which is only set in GitHub Actions")
+	}
+	if err := appendFile(path, []byte(strings.Join(env, "\n")+"\n")); err != nil {
+		return err
+	}
+	// Puts the NDK's llvm-* tools and clang wrappers on PATH
+	if path = os.Getenv("GITHUB_PATH"); path != "" {
+		return appendFile(path, []byte(filepath.Join(t.toolchain, "bin")+"\n"))
+	}
+	return nil
+}
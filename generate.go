@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+)
+
+type generateCommand struct {
+	Run  string `long:"run" value-name:"REGEXP" description:"Only run directives matching REGEXP, passed on as go generate -run"`
+	Skip string `long:"skip" value-name:"REGEXP" description:"Skip directives matching REGEXP, passed on as go generate -skip"`
+	Args struct {
+		Packages []string `positional-arg-name:"PACKAGES" description:"Packages to generate (default: ./...)"`
+	} `positional-args:"yes"`
+}
+
+func (c *generateCommand) Execute([]string) error {
+	args := []string{"go", "generate"}
+	if c.Run != "" {
+		args = append(args, "-run", c.Run)
+	}
+	if c.Skip != "" {
+		args = append(args, "-skip", c.Skip)
+	}
+	if len(c.Args.Packages) == 0 {
+		args = append(args, "./...")
+	}
+	args = append(args, c.Args.Packages...)
+
+	// Run just like any other command, so generators see the same env as a build
+	return forEachABI(func(spec string) error {
+		if code := runABI(spec, args); code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	})
+}
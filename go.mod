@@ -2,6 +2,9 @@ module github.com/iamcalledrob/ndkenv
 
 go 1.18
 
-require github.com/jessevdk/go-flags v1.5.0
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/jessevdk/go-flags v1.5.0
+)
 
 require golang.org/x/sys v0.0.0-20210320140829-1e4c9ba3b0c4 // indirect
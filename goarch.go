@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// clang -march flags matching each GOAMD64 level above the default, v1
+var goamd64Marches = map[string]string{"v2": "-march=x86-64-v2", "v3": "-march=x86-64-v3", "v4": "-march=x86-64-v4"}
+
+// clang flags matching each GO386, so that C code uses floating point the same way
+var go386Flags = map[string][]string{"sse2": {"-msse2", "-mfpmath=sse"}, "softfloat": {"-mno-sse", "-mfpmath=387"}}
+
+// selectCPU applies --goarm, --goarm64, --goamd64 and --go386 to t where they
+// apply to its ABI, returning the clang flags that match
+func (t *target) selectCPU() ([]string, error) {
+	switch {
+	case t.GOARCH == "arm" && opts.GOARM != "":
+		t.GOARM = opts.GOARM
+	case t.GOARCH == "arm64" && opts.GOARM64 != "":
+		march, err := goarm64March(opts.GOARM64)
+		if err != nil {
+			return nil, err
+		}
+		t.GOARM64 = opts.GOARM64
+		return []string{march}, nil
+	case t.GOARCH == "amd64" && opts.GOAMD64 != "":
+		t.GOAMD64 = opts.GOAMD64
+		if march, ok := goamd64Marches[opts.GOAMD64]; ok {
+			return []string{march}, nil
+		}
+	case t.GOARCH == "386" && opts.GO386 != "":
+		t.GO386 = opts.GO386
+		return go386Flags[opts.GO386], nil
+	}
+	return nil, nil
+}
+
+// GOARM64 values, e.g. v8.2,lse,crypto
+var goarm64Pattern = regexp.MustCompile(`^v(8|9)\.(\d)((,lse|,crypto)*)$`)
+
+// goarm64March returns the clang -march flag matching a GOARM64 value, so that
+// C code assumes the same arm64 baseline as Go code
+func goarm64March(goarm64 string) (string, error) {
+	m := goarm64Pattern.FindStringSubmatch(goarm64)
+	if m == nil || m[1] == "9" && m[2] > "5" {
+		return "", fmt.Errorf("invalid --goarm64 %s, expected v8.0 to v8.9 or v9.0 to v9.5, optionally followed by ,lse and ,crypto", goarm64)
+	}
+	march := "-march=armv" + m[1]
+	if m[2] != "0" {
+		march += "." + m[2]
+	}
+	march += "-a"
+	for _, feature := range strings.Split(strings.TrimPrefix(m[3], ","), ",") {
+		if feature != "" {
+			march += "+" + feature
+		}
+	}
+	return march, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// goToolchain is the Go toolchain that the go command selects in the working
+// dir, after any switching due to GOTOOLCHAIN or the module's toolchain directive
+type goToolchain struct {
+	version  string // e.g. go1.22.3
+	setting  string // GOTOOLCHAIN, e.g. auto
+	goarches []string
+}
+
+// isGoCommand reports whether args runs the go command
+func isGoCommand(args []string) bool {
+	return len(args) > 0 && strings.TrimSuffix(filepath.Base(args[0]), ".exe") == "go"
+}
+
+// selectGoToolchain asks the go command which toolchain it'd use with env, and
+// checks that the toolchain can build for t
+func selectGoToolchain(t target, env []string) (goToolchain, error) {
+	out, err := goOutput(env, "env", "GOVERSION", "GOTOOLCHAIN")
+	if err != nil {
+		return goToolchain{}, fmt.Errorf("finding Go toolchain: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		return goToolchain{}, fmt.Errorf("finding Go toolchain: unexpected output from go env: %q", out)
+	}
+	tc := goToolchain{version: lines[0], setting: lines[1]}
+
+	if out, err = goOutput(env, "tool", "dist", "list"); err != nil {
+		return goToolchain{}, fmt.Errorf("listing platforms supported by %s: %w", tc.version, err)
+	}
+	platform := "android/" + t.GOARCH
+	for _, p := range strings.Fields(out) {
+		if strings.HasPrefix(p, "android/") {
+			tc.goarches = append(tc.goarches, strings.TrimPrefix(p, "android/"))
+		}
+	}
+	if !contains(tc.goarches, t.GOARCH) {
+		return goToolchain{}, fmt.Errorf("Go toolchain %s (GOTOOLCHAIN=%s) doesn't support %s", tc.version, tc.setting, platform)
+	}
+	return tc, nil
+}
+
+func goOutput(env []string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Env = env
+	// Switching toolchains may print download progress
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// pin returns a GOTOOLCHAIN value that selects exactly tc, so that it can't
+// change partway through a build. Development builds can't be downloaded, so
+// they must be the local toolchain.
+func (tc goToolchain) pin() string {
+	if strings.HasPrefix(tc.version, "go1") {
+		return tc.version
+	}
+	return "local"
+}
+
+// source describes why tc was selected, for verbose output
+func (tc goToolchain) source() string {
+	if tc.setting != "auto" && !strings.HasSuffix(tc.setting, "+auto") {
+		return "GOTOOLCHAIN=" + tc.setting
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "GOTOOLCHAIN=" + tc.setting
+	}
+	if version, err := moduleGoVersion(wd); err == nil && "go"+version == tc.version {
+		return "required by go.mod"
+	}
+	return "GOTOOLCHAIN=" + tc.setting
+}
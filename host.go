@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// hostABI given to --abi runs the command for the host instead, with the
+// environment left as it is, e.g. to build tools used by the Android build
+const hostABI = "host"
+
+// runHost runs the command without any of the Android setup, returning its exit code
+func runHost(args []string) int {
+	if metrics != nil {
+		metrics.current().ABI = hostABI
+	}
+	args = append([]string(nil), args...)
+	for i, arg := range args {
+		args[i] = strings.ReplaceAll(arg, "{abi}", hostABI)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := runForwardingSignals(cmd); err != nil {
+		return commandExitCode(args[0], err)
+	}
+	return 0
+}
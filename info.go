@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iamcalledrob/ndkenv/ndkenv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type infoCommand struct {
+	Format string `long:"format" default:"text" choice:"text" choice:"json" description:"Print as text, or JSON for provenance records"`
+}
+
+// toolchainInfo describes the NDK in use, for bug reports and provenance records
+type toolchainInfo struct {
+	CreatedBy    string    `json:"created_by"`
+	NDK          string    `json:"ndk"`
+	NDKVersion   string    `json:"ndk_version"`
+	HostTag      string    `json:"host_tag"`
+	Sysroot      string    `json:"sysroot"`
+	ClangVersion string    `json:"clang_version"`
+	LLDVersion   string    `json:"lld_version"`
+	Target       abiInfo   `json:"target"`
+	ABIs         []abiInfo `json:"abis"`
+}
+
+type abiInfo struct {
+	ABI           string `json:"abi"`
+	Triple        string `json:"triple"`
+	MinSDKVersion int    `json:"min_sdk_version,omitempty"`
+	MaxSDKVersion int    `json:"max_sdk_version,omitempty"`
+	Installed     bool   `json:"installed"` // Whether the NDK has the ABI's sysroot headers
+}
+
+var (
+	clangVersion = regexp.MustCompile(`clang version (\S+)`)
+	lldVersion   = regexp.MustCompile(`LLD (\S+)`)
+)
+
+func (c *infoCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	if err = t.check(); err != nil {
+		return err
+	}
+	info := toolchainInfo{
+		CreatedBy: createdBy(),
+		NDK:       t.ndk,
+		HostTag:   filepath.Base(t.toolchain),
+		Sysroot:   t.sysroot,
+		Target:    abiInfo{ABI: t.Name, Triple: t.Triple, MinSDKVersion: t.api, Installed: true},
+	}
+	if info.NDKVersion, err = ndkVersion(t.ndk); err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+	info.ClangVersion = toolVersion(clangVersion, t.clang, "--version")
+	info.LLDVersion = toolVersion(lldVersion, t.ndkConfig().Tool("ld.lld"), "--version")
+
+	platforms, err := readNDKPlatforms(t.ndk)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, name := range ndkenv.ABINames {
+		abi, _ := ndkenv.LookupABI(name)
+		a := abiInfo{ABI: abi.Name, Triple: abi.Triple, MaxSDKVersion: platforms.Max}
+		if a.MinSDKVersion, err = minSDKFloor(t.ndk, abi); err != nil {
+			return err
+		}
+		a.Installed = isDir(filepath.Join(t.sysroot, "usr", "include", abi.Headers))
+		info.ABIs = append(info.ABIs, a)
+	}
+
+	if c.Format == "json" {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Printf("ndkenv:   %s\n", info.CreatedBy)
+	fmt.Printf("NDK:      %s (%s)\n", info.NDKVersion, info.NDK)
+	fmt.Printf("Host tag: %s\n", info.HostTag)
+	fmt.Printf("Sysroot:  %s\n", info.Sysroot)
+	fmt.Printf("clang:    %s\n", info.ClangVersion)
+	fmt.Printf("lld:      %s\n", info.LLDVersion)
+	fmt.Printf("Target:   %s (%s), min SDK version %d\n", t.Name, t.Triple, t.api)
+	fmt.Println("ABIs:")
+	for _, a := range info.ABIs {
+		apis := "API levels unknown"
+		if a.MinSDKVersion != 0 && a.MaxSDKVersion != 0 {
+			apis = fmt.Sprintf("API %d-%d", a.MinSDKVersion, a.MaxSDKVersion)
+		}
+		if !a.Installed {
+			apis = "not installed"
+		}
+		fmt.Printf("  %-12s %-26s %s\n", a.ABI, a.Triple, apis)
+	}
+	return nil
+}
+
+// toolVersion runs a toolchain binary to find its version, returning "unknown"
+// rather than failing, as the rest of the info is still useful
+func toolVersion(pattern *regexp.Regexp, tool string, args ...string) string {
+	out, err := exec.Command(tool, args...).Output()
+	if err != nil {
+		return "unknown"
+	}
+	if m := pattern.FindStringSubmatch(string(out)); m != nil {
+		return m[1]
+	}
+	return "unknown (" + strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]) + ")"
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files that go build reads from the source tree, besides embedded files
+var sourceExts = []string{
+	".go", ".c", ".cc", ".cpp", ".cxx", ".h", ".hh", ".hpp", ".hxx",
+	".m", ".s", ".S", ".sx", ".f", ".F", ".for", ".f90", ".swig", ".swigcxx", ".syso",
+}
+
+// buildInputs is a hash of everything that goes into building an artifact, so
+// that the build can be skipped if none of it has changed since the last one
+type buildInputs struct {
+	hash  string
+	state string // Where the hash of the last successful build is kept
+}
+
+// hashInputs hashes the command, its environment, the NDK version, the
+// project config and lock, and the source tree containing the working dir
+func hashInputs(t target, args []string, env []string, artifact string) (buildInputs, error) {
+	h := sha256.New()
+	version, err := ndkVersion(t.ndk)
+	if err != nil {
+		return buildInputs{}, fmt.Errorf("reading NDK version: %w", err)
+	}
+	fmt.Fprintf(h, "ndkenv %s\nndk %s\n", ndkenvVersion(), version)
+	for _, arg := range args {
+		fmt.Fprintf(h, "arg %q\n", arg)
+	}
+	env = append([]string(nil), env...)
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Fprintf(h, "env %q\n", kv)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return buildInputs{}, err
+	}
+	if path := findConfig(wd); path != "" {
+		for _, file := range []string{path, lockPath(path)} {
+			if err = hashFile(h, file); err != nil && !os.IsNotExist(err) {
+				return buildInputs{}, err
+			}
+		}
+	}
+	artifact, err = filepath.Abs(artifact)
+	if err != nil {
+		return buildInputs{}, err
+	}
+	if err = hashSourceTree(h, moduleRoot(wd), filepath.Dir(artifact)); err != nil {
+		return buildInputs{}, fmt.Errorf("hashing source tree: %w", err)
+	}
+
+	cache, err := ndkCacheDir()
+	if err != nil {
+		return buildInputs{}, err
+	}
+	key := sha256.Sum256([]byte(artifact))
+	return buildInputs{
+		hash:  hex.EncodeToString(h.Sum(nil)),
+		state: filepath.Join(cache, "inputs", hex.EncodeToString(key[:])),
+	}, nil
+}
+
+// upToDate reports whether the last successful build had the same inputs, and
+// its artifact is still there
+func (b buildInputs) upToDate(artifact string) bool {
+	data, err := os.ReadFile(b.state)
+	return err == nil && string(data) == b.hash && isFile(artifact)
+}
+
+// record saves the inputs as those of the last successful build
+func (b buildInputs) record() error {
+	if err := os.MkdirAll(filepath.Dir(b.state), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(b.state, []byte(b.hash), 0644)
+}
+
+// hashSourceTree hashes the path and contents of every source file under root,
+// and of the files they embed, skipping directories that go build ignores and
+// outDir, which the artifact is built into
+func hashSourceTree(h io.Writer, root, outDir string) error {
+	var embeds []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || path == outDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !contains(sourceExts, filepath.Ext(name)) && name != "go.mod" && name != "go.sum" || isGeneratedHeader(path) {
+			return nil
+		}
+		if filepath.Ext(name) == ".go" {
+			patterns, err := embedPatterns(path)
+			if err != nil {
+				return err
+			}
+			embeds = append(embeds, patterns...)
+		}
+		return hashRel(h, root, path)
+	})
+	if err != nil {
+		return err
+	}
+	return hashEmbeds(h, root, embeds)
+}
+
+// isGeneratedHeader reports whether path is the header that go build writes
+// alongside a library built with -buildmode=c-shared or c-archive, which is
+// an output rather than an input (for whichever ABI it was built for)
+func isGeneratedHeader(path string) bool {
+	if filepath.Ext(path) != ".h" {
+		return false
+	}
+	stem := strings.TrimSuffix(path, ".h")
+	return isFile(stem+".so") || isFile(stem+".a")
+}
+
+// embedPatterns returns the patterns of the //go:embed directives in the Go
+// file at path, relative to its directory
+func embedPatterns(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "//go:embed ") {
+			continue
+		}
+		args, err := splitArgs(strings.TrimPrefix(line, "//go:embed "))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, pattern := range args {
+			patterns = append(patterns, filepath.Join(filepath.Dir(path), filepath.FromSlash(pattern)))
+		}
+	}
+	return patterns, nil
+}
+
+// hashEmbeds hashes the files matched by embed patterns, all of the files in
+// matched directories except those go:embed leaves out unless prefixed with all:
+func hashEmbeds(h io.Writer, root string, patterns []string) error {
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		dir, name := filepath.Split(pattern)
+		all := strings.HasPrefix(name, "all:")
+		matches, err := filepath.Glob(dir + strings.TrimPrefix(name, "all:"))
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				hidden := strings.HasPrefix(entry.Name(), ".") || strings.HasPrefix(entry.Name(), "_")
+				switch {
+				case path != match && hidden && !all && entry.IsDir():
+					return filepath.SkipDir
+				case entry.IsDir(), path != match && hidden && !all:
+					return nil
+				}
+				return hashRel(h, root, path)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hashRel hashes the path of the file at path, relative to root, and its contents
+func hashRel(h io.Writer, root, path string) error {
+	rel, _ := filepath.Rel(root, path)
+	fmt.Fprintf(h, "file %q\n", filepath.ToSlash(rel))
+	return hashFile(h, path)
+}
+
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// moduleRoot returns the directory containing the go.mod of dir, or dir itself
+// if it isn't in a module
+func moduleRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if isFile(filepath.Join(d, "go.mod")) {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
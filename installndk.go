@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+type installNDKCommand struct {
+	Repository string `long:"repository" default:"https://dl.google.com/android/repository/repository2-3.xml" value-name:"URL" description:"SDK repository manifest to find the NDK in, for mirrors of Google's"`
+	Args       struct {
+		Version string `positional-arg-name:"VERSION" description:"NDK version to install, e.g. 26.1.10909125, 26 for the newest 26.x or r26b"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+// sdkRepository is the part of an SDK repository manifest listing packages
+// https://dl.google.com/android/repository/repository2-3.xml
+type sdkRepository struct {
+	Packages []struct {
+		Path    string `xml:"path,attr"` // e.g. ndk;26.1.10909125
+		Channel struct {
+			Ref string `xml:"ref,attr"` // e.g. channel-0 for stable
+		} `xml:"channelRef"`
+		Archives []struct {
+			HostOS   string `xml:"host-os"`
+			Size     int64  `xml:"complete>size"`
+			URL      string `xml:"complete>url"`
+			Checksum struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"complete>checksum"`
+		} `xml:"archives>archive"`
+	} `xml:"remotePackage"`
+}
+
+// The least stable SDK repository channel, channel-N, allowed by each --channel
+var sdkChannels = map[string]int{"stable": 0, "beta": 1, "canary": 3}
+
+// Host OS names used by the SDK repository
+var sdkHostOS = map[string]string{"linux": "linux", "darwin": "macosx", "windows": "windows"}
+
+func (c *installNDKCommand) Execute([]string) error {
+	repo, err := fetchSDKRepository(c.Repository)
+	if err != nil {
+		return err
+	}
+	archive, ok := repo.findNDK(c.Args.Version)
+	if !ok {
+		return fmt.Errorf("no %s NDK matching version %s for %s in %s", opts.Channel, c.Args.Version, runtime.GOOS, c.Repository)
+	}
+	version := archive.version
+
+	dst := filepath.Join(androidSDKFolder(), "ndk", version)
+	if isDir(dst) {
+		infof("NDK %s is already installed in %s", version, dst)
+		return nil
+	}
+	// Archive URLs are relative to the manifest's
+	base, err := url.Parse(c.Repository)
+	if err != nil {
+		return err
+	}
+	ref, err := url.Parse(archive.url)
+	if err != nil {
+		return err
+	}
+	archiveURL := base.ResolveReference(ref).String()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(dst), ".download-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	infof("Downloading NDK %s from %s (%d MB)", version, archiveURL, archive.size>>20)
+	err = download(archiveURL, f, archive.checksumType, archive.checksum)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", archiveURL, err)
+	}
+	if err = extractNDK(f.Name(), dst); err != nil {
+		return fmt.Errorf("extracting %s: %w", archiveURL, err)
+	}
+	// Only NDKs in ndkenv's own cache are garbage collected
+	if err = os.Remove(filepath.Join(dst, ndkUsedMarker)); err != nil {
+		return err
+	}
+	infof("Installed NDK %s in %s", version, dst)
+	return nil
+}
+
+// repositoryNDK is the archive of an NDK release for this host
+type repositoryNDK struct {
+	version, url           string
+	checksumType, checksum string
+	size                   int64
+}
+
+// findNDK returns the newest NDK in the repository matching version (or any
+// version, if it's "") on the release channel selected with --channel
+func (r sdkRepository) findNDK(version string) (repositoryNDK, bool) {
+	hostOS := sdkHostOS[runtime.GOOS]
+	var found repositoryNDK
+	for _, p := range r.Packages {
+		v := strings.TrimPrefix(p.Path, "ndk;")
+		if v == p.Path || version != "" && !matchVersion(version, v) || !inChannel(v, version) {
+			continue
+		}
+		// Pre-releases may only be marked as such by their channel
+		if n, err := strconv.Atoi(strings.TrimPrefix(p.Channel.Ref, "channel-")); err == nil && n > sdkChannels[opts.Channel] {
+			continue
+		}
+		if found.version != "" && compareVersions(v, found.version) <= 0 {
+			continue
+		}
+		for _, a := range p.Archives {
+			// Archives without a host-os run on any host
+			if a.HostOS == hostOS || a.HostOS == "" {
+				found = repositoryNDK{v, a.URL, a.Checksum.Type, strings.TrimSpace(a.Checksum.Value), a.Size}
+			}
+		}
+	}
+	return found, found.version != ""
+}
+
+func fetchSDKRepository(manifest string) (sdkRepository, error) {
+	var repo sdkRepository
+	resp, err := http.Get(manifest)
+	if err != nil {
+		return repo, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return repo, fmt.Errorf("fetching %s: %s", manifest, resp.Status)
+	}
+	if err = xml.NewDecoder(resp.Body).Decode(&repo); err != nil {
+		return repo, fmt.Errorf("reading %s: %w", manifest, err)
+	}
+	return repo, nil
+}
+
+// download writes the file at url to w, failing unless it has the published
+// checksum, a sha1 (the default) or sha-256
+func download(url string, w io.Writer, checksumType, checksum string) error {
+	var h hash.Hash
+	switch strings.ToLower(strings.ReplaceAll(checksumType, "-", "")) {
+	case "", "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("unsupported checksum type %s", checksumType)
+	}
+	if checksum == "" {
+		return errors.New("no checksum published to verify the download against")
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	if _, err = io.Copy(io.MultiWriter(w, h), resp.Body); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, checksum) {
+		return fmt.Errorf("checksum mismatch, got %s, expected %s", got, checksum)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"github.com/iamcalledrob/ndkenv/ndkenv"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// androidProject is a React Native, Flutter or Android project that consumes native libraries
+// from a jniLibs folder
+type androidProject struct {
+	kind    string // e.g. "React Native app"
+	jniLibs string
+	gradle  string // build.gradle(.kts) of the module jniLibs belongs to
+	android string // The project's android folder, with the root build.gradle(.kts)
+}
+
+// findAndroidProject looks for a React Native, Flutter or Android project in dir and each of its parents
+func findAndroidProject(dir string) (androidProject, error) {
+	for {
+		if p, ok := detectAndroidProject(dir); ok {
+			return p, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return androidProject{}, fmt.Errorf("no React Native, Flutter or Android project found")
+		}
+		dir = parent
+	}
+}
+
+// Matches the flutter sdk dependency (or plugin section) of a pubspec.yaml
+var flutterDependency = regexp.MustCompile(`(?m)^\s+flutter:`)
+
+func detectAndroidProject(dir string) (androidProject, bool) {
+	var framework string
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil && strings.Contains(string(data), `"react-native"`) {
+		framework = "React Native"
+	} else if data, err := os.ReadFile(filepath.Join(dir, "pubspec.yaml")); err == nil && flutterDependency.Match(data) {
+		framework = "Flutter"
+	} else if isFile(filepath.Join(dir, "android", "settings.gradle")) || isFile(filepath.Join(dir, "android", "settings.gradle.kts")) {
+		// A plain Gradle project, e.g. from ndkenv init-android
+		framework = "Android"
+	} else {
+		return androidProject{}, false
+	}
+
+	// Apps keep their native code in the app module, whereas libraries (native
+	// modules and plugins) have a single module at the root of android/
+	module, kind := filepath.Join(dir, "android", "app"), framework+" app"
+	if !isDir(module) {
+		module, kind = filepath.Join(dir, "android"), framework+" library"
+	}
+	if !isDir(module) {
+		return androidProject{}, false
+	}
+	p := androidProject{
+		kind:    kind,
+		jniLibs: filepath.Join(module, "src", "main", "jniLibs"),
+		android: filepath.Join(dir, "android"),
+	}
+	for _, name := range []string{"build.gradle", "build.gradle.kts"} {
+		if path := filepath.Join(module, name); isFile(path) {
+			p.gradle = path
+			break
+		}
+	}
+	return p, true
+}
+
+// abiFilter matches both Groovy (abiFilters 'x86', "arm64-v8a") and Kotlin
+// (abiFilters += listOf("x86")) declarations
+var abiFilter = regexp.MustCompile(`abiFilters[^\n]*`)
+var quoted = regexp.MustCompile(`["']([\w-]+)["']`)
+
+// enabledABIs returns the ABIs listed in the module's abiFilters, or nil if
+// there aren't any filters, meaning every ABI is packaged
+func (p androidProject) enabledABIs() ([]string, error) {
+	if p.gradle == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(p.gradle)
+	if err != nil {
+		return nil, err
+	}
+	var abis []string
+	for _, line := range abiFilter.FindAllString(string(data), -1) {
+		for _, m := range quoted.FindAllStringSubmatch(line, -1) {
+			abis = append(abis, m[1])
+		}
+	}
+	return abis, nil
+}
+
+// Matches minSdk = 21 and minSdkVersion(21) in Kotlin, minSdkVersion 21 in
+// Groovy, or a reference to a variable holding it, e.g. flutter.minSdkVersion
+var gradleMinSDK = regexp.MustCompile(`\bminSdk(?:Version)?(?:\s*[=(]\s*|\s+)([\w.]+)`)
+
+// Matches android:minSdkVersion="21" in AndroidManifest.xml's uses-sdk
+var manifestMinSDK = regexp.MustCompile(`android:minSdkVersion\s*=\s*"(\d+)"`)
+
+// minSDK returns the module's min SDK version and the file it's set in. React
+// Native modules refer to a variable set in the root build.gradle, which is
+// read in turn. Flutter's is set by the Flutter SDK, so can't be read.
+func (p androidProject) minSDK() (int, string, error) {
+	var unresolved string
+	for _, gradle := range []string{p.gradle, filepath.Join(p.android, "build.gradle"), filepath.Join(p.android, "build.gradle.kts")} {
+		data, err := os.ReadFile(gradle)
+		if err != nil {
+			continue
+		}
+		for _, m := range gradleMinSDK.FindAllStringSubmatch(string(data), -1) {
+			if api, err := strconv.Atoi(m[1]); err == nil {
+				return api, gradle, nil
+			}
+			if unresolved == "" {
+				unresolved = fmt.Sprintf("%s sets minSdk to %s", gradle, m[1])
+			}
+		}
+	}
+	// Gradle's setting overrides the manifest's
+	if unresolved != "" {
+		return 0, "", fmt.Errorf("%s, which ndkenv can't evaluate, pass the min SDK version instead", unresolved)
+	}
+	manifest := filepath.Join(filepath.Dir(p.jniLibs), "AndroidManifest.xml")
+	if data, err := os.ReadFile(manifest); err == nil {
+		if m := manifestMinSDK.FindSubmatch(data); m != nil {
+			api, _ := strconv.Atoi(string(m[1]))
+			return api, manifest, nil
+		}
+	}
+	return 0, "", fmt.Errorf("no minSdk found in the %s's build.gradle or AndroidManifest.xml", p.kind)
+}
+
+// installJNILib copies a built library into the project's jniLibs folder for abi.
+// Does nothing (except warn) if the project's gradle config doesn't enable abi.
+func installJNILib(p androidProject, abi ndkenv.ABI, lib string) error {
+	enabled, err := p.enabledABIs()
+	if err != nil {
+		return fmt.Errorf("reading ABIs enabled in %s: %w", p.gradle, err)
+	}
+	if len(enabled) > 0 && !contains(enabled, abi.Name) {
+		warnf("not copying %s to jniLibs, %s isn't in abiFilters of %s (%s)",
+			lib, abi.Name, p.gradle, strings.Join(enabled, ", "))
+		return nil
+	}
+
+	dir := filepath.Join(p.jniLibs, abi.Name)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, filepath.Base(lib))
+	if err = copyFile(lib, dst); err != nil {
+		return err
+	}
+	verbosef("Copied %s to %s (%s)", lib, dst, p.kind)
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// testEvent is a line of output from go test -json
+type testEvent struct {
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64
+	Output      string
+	ImportPath  string // Of build-output events, from Go 1.24
+	FailedBuild string // ImportPath of the build that made a package fail
+}
+
+// junitReport collects the results of go test -json as they're written, in
+// order to write them as JUnit XML once the tests have finished
+type junitReport struct {
+	path     string
+	abi      string
+	line     []byte // Incomplete last line written
+	packages []*junitPackage
+	builds   map[string]*strings.Builder // Build output, by ImportPath
+}
+
+type junitPackage struct {
+	name    string
+	elapsed float64
+	failed  bool
+	output  strings.Builder // Output that isn't from a test, e.g. build errors
+	tests   []*junitTest
+}
+
+type junitTest struct {
+	name    string
+	action  string // pass, fail or skip, or "" if the test didn't finish
+	elapsed float64
+	output  strings.Builder
+}
+
+// junitArgs checks args is a go test command with JSON output to parse
+func junitArgs(args []string) error {
+	if len(args) < 2 || !isGoCommand(args) || args[1] != "test" || !(contains(args, "-json") || contains(args, "-json=true")) {
+		return errors.New("--junit needs the output of go test -json, e.g. go test -json ./...")
+	}
+	return nil
+}
+
+func newJUnitReport(path string, t target) *junitReport {
+	return &junitReport{path: path, abi: t.Name, builds: make(map[string]*strings.Builder)}
+}
+
+func (r *junitReport) Write(p []byte) (int, error) {
+	r.line = append(r.line, p...)
+	for {
+		i := strings.IndexByte(string(r.line), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		r.parseLine(r.line[:i])
+		r.line = r.line[i+1:]
+	}
+}
+
+func (r *junitReport) parseLine(line []byte) {
+	var e testEvent
+	if err := json.Unmarshal(line, &e); err != nil {
+		return // Not an event, e.g. output from go vet
+	}
+	if e.Action == "build-output" {
+		if r.builds[e.ImportPath] == nil {
+			r.builds[e.ImportPath] = &strings.Builder{}
+		}
+		r.builds[e.ImportPath].WriteString(e.Output)
+		return
+	}
+	if e.Package == "" {
+		return
+	}
+	pkg := r.pkg(e.Package)
+	if e.Test == "" {
+		switch e.Action {
+		case "output":
+			pkg.output.WriteString(e.Output)
+		case "pass", "fail", "skip":
+			pkg.elapsed, pkg.failed = e.Elapsed, e.Action == "fail"
+			if build := r.builds[e.FailedBuild]; build != nil {
+				pkg.output.WriteString(build.String())
+			}
+		}
+		return
+	}
+	test := pkg.test(e.Test)
+	switch e.Action {
+	case "output":
+		test.output.WriteString(e.Output)
+	case "pass", "fail", "skip":
+		test.action, test.elapsed = e.Action, e.Elapsed
+	}
+}
+
+func (r *junitReport) pkg(name string) *junitPackage {
+	for _, p := range r.packages {
+		if p.name == name {
+			return p
+		}
+	}
+	p := &junitPackage{name: name}
+	r.packages = append(r.packages, p)
+	return p
+}
+
+func (p *junitPackage) test(name string) *junitTest {
+	for _, t := range p.tests {
+		if t.name == name {
+			return t
+		}
+	}
+	t := &junitTest{name: name}
+	p.tests = append(p.tests, t)
+	return t
+}
+
+type junitXMLSuites struct {
+	XMLName xml.Name        `xml:"testsuites"`
+	Suites  []junitXMLSuite `xml:"testsuite"`
+}
+
+type junitXMLSuite struct {
+	Name       string             `xml:"name,attr"`
+	Tests      int                `xml:"tests,attr"`
+	Failures   int                `xml:"failures,attr"`
+	Skipped    int                `xml:"skipped,attr"`
+	Time       string             `xml:"time,attr"`
+	Properties []junitXMLProperty `xml:"properties>property"`
+	Cases      []junitXMLCase     `xml:"testcase"`
+}
+
+type junitXMLProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitXMLCase struct {
+	Name      string           `xml:"name,attr"`
+	Classname string           `xml:"classname,attr"`
+	Time      string           `xml:"time,attr"`
+	Failure   *junitXMLMessage `xml:"failure"`
+	Skipped   *junitXMLMessage `xml:"skipped"`
+}
+
+type junitXMLMessage struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// Close parses anything left over and writes the report
+func (r *junitReport) Close() error {
+	if len(r.line) > 0 {
+		r.parseLine(r.line)
+	}
+	var report junitXMLSuites
+	for _, p := range r.packages {
+		// The ABI is part of the suite name, so that results for each ABI can
+		// be told apart when a CI system shows them together
+		suite := junitXMLSuite{
+			Name:       fmt.Sprintf("%s [%s]", p.name, r.abi),
+			Time:       fmt.Sprintf("%.3f", p.elapsed),
+			Properties: []junitXMLProperty{{Name: "abi", Value: r.abi}},
+		}
+		failedTests := false
+		for _, t := range p.tests {
+			c := junitXMLCase{Name: t.name, Classname: p.name, Time: fmt.Sprintf("%.3f", t.elapsed)}
+			switch t.action {
+			case "fail", "":
+				c.Failure = &junitXMLMessage{Message: "Failed", Output: t.output.String()}
+				if t.action == "" {
+					c.Failure.Message = "Didn't finish"
+				}
+				suite.Failures++
+				failedTests = true
+			case "skip":
+				c.Skipped = &junitXMLMessage{Message: "Skipped", Output: t.output.String()}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		// A package can fail without a failing test, e.g. if it doesn't build
+		if p.failed && !failedTests {
+			suite.Cases = append(suite.Cases, junitXMLCase{
+				Name:      "[package]",
+				Classname: p.name,
+				Time:      suite.Time,
+				Failure:   &junitXMLMessage{Message: "Failed", Output: p.output.String()},
+			})
+			suite.Failures++
+		}
+		suite.Tests = len(suite.Cases)
+		report.Suites = append(report.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
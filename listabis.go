@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iamcalledrob/ndkenv/ndkenv"
+	"os"
+	"sort"
+)
+
+type listABIsCommand struct {
+	Format string `long:"format" default:"text" choice:"text" choice:"json" description:"Print as text, or JSON for tools to parse"`
+}
+
+// abiListing describes an ABI of the NDK, and how ndkenv builds for it
+type abiListing struct {
+	ABI        string `json:"abi"`  // Android name, as in jniLibs
+	Flag       string `json:"flag"` // As passed to --abi, or "" if ndkenv can't build for it
+	GOARCH     string `json:"goarch,omitempty"`
+	GOARM      string `json:"goarm,omitempty"`
+	Triple     string `json:"triple"`
+	Bitness    int    `json:"bitness,omitempty"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+}
+
+func (c *listABIsCommand) Execute([]string) error {
+	projectCfg, projectLock, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if err = locateNDK(projectCfg, projectLock); err != nil {
+		return err
+	}
+	version, err := ndkVersion(opts.NDK)
+	if err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+
+	// Older NDKs have no meta/abis.json, so only ndkenv's own ABIs are known
+	var abis []abiListing
+	known := make(map[string]bool)
+	for _, name := range ndkenv.ABINames {
+		abi, _ := ndkenv.LookupABI(name)
+		abis = append(abis, abiListing{ABI: abi.Name, Flag: name, GOARCH: abi.GOARCH, GOARM: abi.GOARM, Triple: abi.Triple})
+		known[abi.Name] = true
+	}
+	meta, err := readNDKABIs(opts.NDK)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := range abis {
+		if m, ok := meta[abis[i].ABI]; ok {
+			abis[i].Bitness, abis[i].Deprecated = m.Bitness, m.Deprecated
+		}
+	}
+	var extra []string
+	for name := range meta {
+		if !known[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		m := meta[name]
+		listing := abiListing{ABI: name, Triple: m.Triple, Bitness: m.Bitness, Deprecated: m.Deprecated}
+		if abi, err := metaABI(opts.NDK, name); err == nil {
+			listing.Flag, listing.GOARCH = name, abi.GOARCH
+		}
+		abis = append(abis, listing)
+	}
+
+	if c.Format == "json" {
+		data, err := json.MarshalIndent(abis, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Printf("NDK %s (%s)\n", version, opts.NDK)
+	for _, a := range abis {
+		goarch := "not supported by ndkenv"
+		if a.Flag != "" {
+			goarch = "GOARCH=" + a.GOARCH
+			if a.GOARM != "" {
+				goarch += " GOARM=" + a.GOARM
+			}
+		}
+		note := ""
+		if a.Bitness != 0 {
+			note = fmt.Sprintf("%d-bit", a.Bitness)
+		}
+		if a.Deprecated {
+			note += ", deprecated"
+		}
+		fmt.Printf("  %-12s %-12s %-26s %-24s %s\n", a.ABI, a.Flag, a.Triple, goarch, note)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/iamcalledrob/ndkenv/ndkenv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type listNDKsCommand struct {
+	Format string `long:"format" default:"text" choice:"text" choice:"json" description:"Print as text, or JSON for tools to parse"`
+}
+
+// ndkListing describes an NDK found by ndkenv, whether or not it'd be used
+type ndkListing struct {
+	Path          string   `json:"path"`
+	Version       string   `json:"version"`
+	Source        string   `json:"source"`   // Where it was found, e.g. $ANDROID_NDK_HOME
+	HostTag       string   `json:"host_tag"` // Of the toolchain this host would use
+	ABIs          []string `json:"abis"`     // Those with sysroot headers for that toolchain
+	MinSDKVersion int      `json:"min_sdk_version,omitempty"`
+	MaxSDKVersion int      `json:"max_sdk_version,omitempty"`
+	Selected      bool     `json:"selected"`
+}
+
+func (c *listNDKsCommand) Execute([]string) error {
+	projectCfg, projectLock, err := loadProject()
+	if err != nil {
+		return err
+	}
+	var ndks []ndkListing
+	for _, source := range ndkSources() {
+		ndks = append(ndks, ndkListing{Path: source.dir, Source: source.name})
+	}
+	ndkFolder := filepath.Join(androidSDKFolder(), "ndk")
+	installed, err := sdkNDKs(ndkFolder)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, ndk := range installed {
+		ndks = append(ndks, ndkListing{Path: ndk.dir, Source: "SDK"})
+	}
+	for _, ndk := range searchPathNDKs(ndkSearchPaths(projectCfg)) {
+		if !containsNDK(ndks, ndk.dir) {
+			ndks = append(ndks, ndkListing{Path: ndk.dir, Source: "search path"})
+		}
+	}
+
+	// Find the NDK that would be used, quietly, as a build would find it
+	verbose, debug := opts.Verbose, opts.Debug
+	opts.Verbose, opts.Debug = false, false
+	locateErr := locateNDK(projectCfg, projectLock)
+	opts.Verbose, opts.Debug = verbose, debug
+	selected := opts.NDK
+	if locateErr != nil {
+		warnf("%s", locateErr)
+	} else if !containsNDK(ndks, selected) {
+		ndks = append(ndks, ndkListing{Path: selected, Source: "--ndk, --ndk-archive or the config"})
+	}
+
+	for i := range ndks {
+		n := &ndks[i]
+		if n.HostTag, err = ndkHostTag(n.Path); err != nil {
+			n.HostTag = "linux-x86_64"
+		}
+		n.Selected = locateErr == nil && sameFile(n.Path, selected)
+		if n.Version, err = ndkVersion(n.Path); err != nil {
+			n.Version = "unknown"
+		}
+		for _, name := range ndkenv.ABINames {
+			abi, _ := ndkenv.LookupABI(name)
+			if isDir(ndkenv.Config{ABI: abi, NDK: n.Path, HostTag: n.HostTag}.ISystem()) {
+				n.ABIs = append(n.ABIs, abi.Name)
+			}
+		}
+		if platforms, err := readNDKPlatforms(n.Path); err == nil {
+			n.MinSDKVersion, n.MaxSDKVersion = platforms.Min, platforms.Max
+		}
+	}
+
+	if c.Format == "json" {
+		data, err := json.MarshalIndent(ndks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(ndks) == 0 {
+		fmt.Printf("No NDKs found, install one with sdkmanager or Android Studio into %s\n", ndkFolder)
+		return nil
+	}
+	for _, n := range ndks {
+		mark := " "
+		if n.Selected {
+			mark = "*"
+		}
+		apis := "API levels unknown"
+		if n.MinSDKVersion != 0 && n.MaxSDKVersion != 0 {
+			apis = fmt.Sprintf("API %d-%d", n.MinSDKVersion, n.MaxSDKVersion)
+		}
+		abis := strings.Join(n.ABIs, ", ")
+		if abis == "" {
+			abis = "no ABIs for " + n.HostTag
+		}
+		fmt.Printf("%s %-22s %s\n    from %s, %s, %s\n", mark, n.Version, n.Path, n.Source, apis, abis)
+	}
+	return nil
+}
+
+func containsNDK(ndks []ndkListing, path string) bool {
+	for _, n := range ndks {
+		if sameFile(n.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile reports whether a and b are the same file, even if named differently
+func sameFile(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	return err == nil && os.SameFile(aInfo, bInfo)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localProperty returns the value of key (e.g. sdk.dir) in the local.properties
+// of the Android project containing the working dir, where Android Studio
+// records the paths the Gradle build uses, or "" if there isn't one
+func localProperty(key string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	wd := dir
+	for {
+		// React Native and Flutter keep the Gradle project in android/
+		for _, path := range []string{filepath.Join(dir, "local.properties"), filepath.Join(dir, "android", "local.properties")} {
+			if props, err := readProperties(path); err == nil {
+				if props[key] == "" {
+					explain("%s isn't set in %s", key, path)
+				}
+				return props[key]
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			explain("no local.properties for %s in %s or its parents", key, wd)
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readProperties reads a Java .properties file, as far as local.properties uses
+// the format: key=value lines, with backslash escapes such as C\:\\sdk on Windows
+func readProperties(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			continue
+		}
+		props[strings.TrimSpace(line[:i])] = unescapeProperty(strings.TrimSpace(line[i+1:]))
+	}
+	return props, scanner.Err()
+}
+
+func unescapeProperty(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
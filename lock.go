@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"path/filepath"
+)
+
+const lockFileName = ".ndkenv.lock"
+
+// lock pins the exact NDK version that the project's ndk_version resolved to
+// when it was last set with ndkenv use, so that installing a newer matching NDK
+// doesn't change the toolchain under everyone's feet.
+type lock struct {
+	NDKVersion string `toml:"ndk_version"`
+	// The ndk_version that NDKVersion was resolved from. When it no longer
+	// matches the config, the lock is stale and is ignored.
+	Constraint string `toml:"constraint"`
+}
+
+// lockPath returns the path of the lockfile that goes with a config file
+func lockPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), lockFileName)
+}
+
+// readLock reads the lockfile at path, returning an empty lock if there isn't one
+func readLock(path string) (lock, error) {
+	var l lock
+	if _, err := toml.DecodeFile(path, &l); err != nil && !os.IsNotExist(err) {
+		return l, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func writeLock(path string, l lock) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(f, "# Generated by ndkenv use. Commit this file so that everyone builds with the same NDK.")
+	if err = toml.NewEncoder(f).Encode(l); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
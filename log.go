@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// logLevel is the importance of one of ndkenv's own messages, as opposed to the
+// output of the command it runs. Errors are always printed, then warnings and
+// info unless --quiet, verbose messages with -v and debug ones with --debug.
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarning
+	levelInfo
+	levelVerbose
+	levelDebug
+)
+
+var levelNames = [...]string{"error", "warning", "info", "verbose", "debug"}
+
+// Prefixes of messages at each level when not logging JSON
+var levelPrefixes = [...]string{"Fatal: ", "Warning: ", "", "", "Debug: "}
+
+// logEntry is a line printed with --log-json
+type logEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"msg"`
+}
+
+// maxLevel returns the least important level of message to print
+func maxLevel() logLevel {
+	switch {
+	case opts.Debug:
+		return levelDebug
+	case opts.Verbose:
+		return levelVerbose
+	case opts.Quiet:
+		return levelError
+	default:
+		return levelInfo
+	}
+}
+
+func logf(level logLevel, format string, args ...interface{}) {
+	if level <= maxLevel() {
+		writeLog(level, levelPrefixes[level], fmt.Sprintf(format, args...))
+	}
+}
+
+// writeLog prints msg to stderr, kept apart from the command's output on
+// stdout, as a line of JSON with --log-json or else with prefix
+func writeLog(level logLevel, prefix, msg string) {
+	if opts.LogJSON {
+		data, _ := json.Marshal(logEntry{time.Now(), levelNames[level], msg})
+		os.Stderr.Write(append(data, '\n'))
+		return
+	}
+	fmt.Fprintln(os.Stderr, prefix+msg)
+}
+
+func fatalf(format string, args ...interface{})   { logf(levelError, format, args...) }
+func warnf(format string, args ...interface{})    { logf(levelWarning, format, args...) }
+func infof(format string, args ...interface{})    { logf(levelInfo, format, args...) }
+func verbosef(format string, args ...interface{}) { logf(levelVerbose, format, args...) }
+func debugf(format string, args ...interface{})   { logf(levelDebug, format, args...) }
@@ -4,89 +4,581 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jessevdk/go-flags"
+	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const description = `
+Example: ndkenv -a arm64-v8a -s 21 go build -o libfoo.so .
+
 Configures environment variables for cross-compiling cgo projects with the Android NDK:
 - CGO_ENABLED: 1
 - CC: C compiler and flags for relevant ABI and SDK version
-- CGO_CFLAGS: Passes -isystem in order to locate header files
+- AS: Assembler (the C compiler) and flags, for build systems that assemble separately
+- AR, RANLIB, NM, STRIP, LD: The NDK's llvm-ar, llvm-ranlib, llvm-nm, llvm-strip and ld.lld
+- CGO_CPPFLAGS: Passes -isystem in order to locate header files, and any defines
+- CGO_CFLAGS: Any cflags from the config
 - GOOS: android
 - GOARCH: Architecture used by go build, mapped from ABI
 - GOARM: ARM version, set when needed based on ABI
+- GOARM64, GOAMD64, GO386: arm64, x86-64 and x86 baselines, set with --goarm64, --goamd64 and --go386
+
+Options can also be set with NDKENV_* environment variables, or defaults
+set in a .ndkenv.toml file in the project directory (or any parent). Values may reference environment variables
+as ${VAR}, or ${VAR:-default} to fall back when VAR is unset.
 `
 
 var opts struct {
-	Verbose       bool   `short:"v" long:"verbose" description:"Print the env to stdout before running command"`
-	ABI           string `short:"a" long:"abi" description:"Android ABI to target, e.g. arm64-v8a" required:"true"`
-	NDK           string `long:"ndk" description:"Path to NDK install. Optional, if unspecified then NDK will be located automatically"`
-	MinSDKVersion int    `short:"s" long:"min-sdk-version" description:"Minimum android SDK version" required:"true"`
+	// The ABI being targeted, one of ABIs (or from the config)
+	ABI string
+
+	Verbose        bool     `short:"v" long:"verbose" env:"NDKENV_VERBOSE" description:"Print the env to stderr before running command, and more about what ndkenv is doing"`
+	Quiet          bool     `short:"q" long:"quiet" env:"NDKENV_QUIET" description:"Print only errors, not warnings or progress such as which ABI is being run for"`
+	Debug          bool     `long:"debug" env:"NDKENV_DEBUG" description:"Print everything -v does, and also each step of locating the NDK (as --explain-discovery does) and the command run"`
+	LogJSON        bool     `long:"log-json" env:"NDKENV_LOG_JSON" description:"Print ndkenv's own messages to stderr as lines of JSON, with their time, level and msg, so they can be told apart from the command's output"`
+	ABIs           []string `short:"a" long:"abi" env:"NDKENV_ABI" env-delim:"," description:"Android ABI to target, e.g. arm64-v8a (or another name for it, such as aarch64 or arm64, in any case), or host. Repeat (or pass all) to run the command for each ABI in turn, optionally with its own min SDK version as abi:version, e.g. -a arm64-v8a:21 -a x86-64:26"`
+	Host           bool     `long:"host" env:"NDKENV_HOST" description:"Run the command for the host, with the environment left as it is, so scripts can run every build through ndkenv. The same as -a host, which can be repeated alongside Android ABIs"`
+	NDK            string   `long:"ndk" env:"NDKENV_NDK" description:"Path to NDK install. Optional, if unspecified then NDK will be located automatically"`
+	NDKArchive     string   `long:"ndk-archive" env:"NDKENV_NDK_ARCHIVE" value-name:"ZIP" description:"NDK release archive to use, extracted into a cache shared between projects on first use"`
+	NDKSearchPath  []string `long:"ndk-search-path" env:"NDKENV_NDK_SEARCH_PATH" env-delim:"," value-name:"DIR" description:"Folder to look for an NDK in alongside the SDK's, either an NDK itself or a folder of them, such as where Homebrew, Nix or Chocolatey install it. Repeat for several"`
+	ExplainNDK     bool     `long:"explain-discovery" env:"NDKENV_EXPLAIN_DISCOVERY" description:"Report every place checked for the NDK (local.properties, environment variables, the SDK and --ndk-search-path) to stderr, and why each NDK found was skipped"`
+	NoCache        bool     `long:"no-cache" env:"NDKENV_NO_CACHE" description:"Look for the NDK again, rather than using the one an earlier run found with the same options, which is cached until an NDK is installed in or removed from a folder it looked in"`
+	NDKPolicy      string   `long:"ndk-policy" env:"NDKENV_NDK_POLICY" default:"newest" choice:"newest" choice:"oldest" choice:"error" description:"Which NDK to use when several installed NDKs match --ndk-version: newest, oldest, or error to fail"`
+	Channel        string   `long:"channel" env:"NDKENV_CHANNEL" default:"stable" choice:"stable" choice:"beta" choice:"canary" description:"Release channel of installed NDKs to consider: stable, beta (also release candidates) or canary (anything)"`
+	NDKVersion     string   `long:"ndk-version" env:"NDKENV_NDK_VERSION" description:"Version of NDK to locate automatically, e.g. 26, 26.1.*, the release r26b or constraints such as >=25,<27. Any installed NDK may be used if unset"`
+	AutoInstall    bool     `long:"auto-install" env:"NDKENV_AUTO_INSTALL" description:"Install the NDK with sdkmanager (on PATH or in the SDK's cmdline-tools) if none matching --ndk-version is installed"`
+	AcceptLicenses bool     `long:"accept-licenses" env:"NDKENV_ACCEPT_LICENSES" description:"Accept the SDK licenses when sdkmanager asks, with --auto-install, rather than leaving it to the user"`
+	HostTag        string   `long:"host-tag" env:"NDKENV_HOST_TAG" description:"Host tag of the NDK toolchain to use, e.g. linux-x86_64, when it can't be worked out from this host, such as when running it under emulation (default: the NDK's native toolchain for this host if it has one, otherwise <os>-x86_64)"`
+	GOARM          string   `long:"goarm" env:"NDKENV_GOARM" choice:"5" choice:"6" choice:"7" description:"GOARM to build 32-bit ARM ABIs with, e.g. 6 for armeabi on ARMv6 devices, rather than 5 for armeabi or 7 for armeabi-v7a"`
+	GOARM64        string   `long:"goarm64" env:"NDKENV_GOARM64" value-name:"VERSION" description:"GOARM64 to build arm64-v8a with, e.g. v8.2,lse,crypto, for devices with newer arm64 baselines. C code is built with the matching -march, e.g. -march=armv8.2-a+lse+crypto"`
+	GOAMD64        string   `long:"goamd64" env:"NDKENV_GOAMD64" choice:"v1" choice:"v2" choice:"v3" choice:"v4" description:"GOAMD64 to build x86-64 with, e.g. v3 for emulator-only builds on hosts with AVX2. C code is built with the matching -march, e.g. -march=x86-64-v3"`
+	GO386          string   `long:"go386" env:"NDKENV_GO386" choice:"sse2" choice:"softfloat" description:"GO386 to build x86 with, e.g. softfloat for very old emulator images without SSE2. C code is built with matching floating point flags, e.g. -mno-sse -mfpmath=387"`
+	MinSDKVersion  apiLevel `short:"s" long:"min-sdk-version" env:"NDKENV_MIN_SDK_VERSION" value-name:"API" description:"Minimum android SDK version, auto for the lowest the NDK supports for the ABI, or project for the minSdk of the surrounding Android project's app module"`
+	ClampSDK       bool     `long:"clamp-sdk" env:"NDKENV_CLAMP_SDK" description:"Raise the min SDK version to the lowest the NDK supports for the ABI, or lower it to the highest, rather than failing, if it's outside that range"`
+	Prefab         []string `long:"prefab" env:"NDKENV_PREFAB" env-delim:"," value-name:"AAR" description:"AAR containing a Prefab package to build against, adding its headers and libraries for the ABI to the flags. Repeat for each AAR, in addition to any prefab in the config"`
+	Env            []string `long:"env" env:"NDKENV_ENV" env-delim:"," value-name:"KEY=VALUE" description:"Variable to set alongside ndkenv's own, e.g. OPENSSL_DIR=/opt/openssl, replacing any of the same name, including ndkenv's. {abi}, {api} and {out} are replaced as in the command. Repeat for each variable, in addition to any in env in the config"`
+	Link           []string `long:"link" env:"NDKENV_LINK" env-delim:"," value-name:"LIB" description:"Library from the NDK's sysroot to link against, e.g. log, android or EGL, added to CGO_LDFLAGS as -lLIB once it's checked to exist at the min SDK version. Repeat for each library, in addition to any link in the config"`
+	Profile        string   `short:"p" long:"profile" env:"NDKENV_PROFILE" description:"Name of a profile from .ndkenv.toml to apply"`
+	PinGoToolchain bool     `long:"pin-gotoolchain" env:"NDKENV_PIN_GOTOOLCHAIN" description:"Set GOTOOLCHAIN to the Go toolchain selected now, so that toolchain switching can't change the compiler partway through a build"`
+	NoCompatCheck  bool     `long:"no-compat-check" env:"NDKENV_NO_COMPAT_CHECK" description:"Don't warn about combinations of Go and NDK versions with known problems"`
+	PrependPath    bool     `long:"prepend-path" env:"NDKENV_PREPEND_PATH" description:"Put the NDK toolchain's bin directory at the front of PATH for the command (and ndkenv shell), so scripts running clang, llvm-strip or the target-prefixed clang wrappers by name get the NDK's"`
+	RespectEnv     string   `long:"respect-env" env:"NDKENV_RESPECT_ENV" value-name:"VARS" description:"Comma-separated variables, e.g. GOARM,GOARCH, to leave as they are (with a warning) if already set in the environment, rather than overriding them"`
+	BuildVCS       string   `long:"buildvcs" env:"NDKENV_BUILDVCS" choice:"on" choice:"off" choice:"auto" description:"Whether go commands stamp binaries with version control information, passed on as -buildvcs through GOFLAGS"`
+	Stamp          bool     `long:"stamp" env:"NDKENV_STAMP" description:"Set the string variables ndkenvABI, ndkenvAPI and ndkenvNDK in package main to the ABI, min SDK version and NDK version built for, via the go command's -ldflags"`
+	Strict         bool     `long:"strict" env:"NDKENV_STRICT" description:"Fail, rather than warn, when the environment already sets GOOS, GOARCH, GOARM, CC or CGO_ENABLED to something other than ndkenv's value for the target"`
+	Isolate        bool     `long:"isolate" env:"NDKENV_ISOLATE" description:"Run the command with only ndkenv's variables, PATH, HOME, USER, TERM, TMPDIR and those the go command needs to find its caches and modules (GOROOT, GOPATH, GOMODCACHE, GOCACHE, GOPROXY and the like), plus any named in --respect-env, so CC, CFLAGS, GOFLAGS and the like set for the host can't leak into the build"`
+	Sandbox        string   `long:"sandbox" env:"NDKENV_SANDBOX" value-name:"DIR" description:"Keep GOPATH, GOMODCACHE and GOCACHE inside DIR, downloading the module's dependencies into it first, for isolated builds that can be cleaned up by deleting DIR"`
+	Timestamps     bool     `long:"timestamps" env:"NDKENV_TIMESTAMPS" description:"Prefix each line the command outputs with the time elapsed since it started"`
+	Tee            string   `long:"tee" env:"NDKENV_TEE" value-name:"FILE" description:"Also write the command's combined stdout and stderr to FILE"`
+	TraceToolchain string   `long:"trace-toolchain" env:"NDKENV_TRACE_TOOLCHAIN" value-name:"FILE" description:"Run the go command with -x -work, logging each toolchain invocation to FILE as JSON lines and summarizing them afterwards"`
+	JUnit          string   `long:"junit" env:"NDKENV_JUNIT" value-name:"FILE" description:"Write the results of the go test -json command to FILE as JUnit XML, for CI systems to display"`
+	IfChanged      bool     `long:"if-changed" env:"NDKENV_IF_CHANGED" description:"Skip the command for an ABI if its library is still there and nothing that goes into building it (the command, env, NDK version, config, source files and files they embed) has changed since it last succeeded"`
+	Metrics        string   `long:"metrics" env:"NDKENV_METRICS" value-name:"FILE" description:"Write metrics of the build for each ABI to FILE as JSON: durations, exit codes, how many Go packages were already in the build cache, and the size of the library built"`
+	Dist           string   `long:"dist" env:"NDKENV_DIST" value-name:"ZIP" description:"After building for every ABI, write the libraries, their headers and a metadata file to a single archive"`
+	WriteEnv       string   `long:"write-env" env:"NDKENV_WRITE_ENV" value-name:"FILE" description:"Write the environment to FILE in dotenv format, for docker compose and other tools to load, before running the command if one is given. {abi} and {api} in FILE are replaced, for writing one file per ABI"`
+	JNILibs        string   `long:"jnilibs" env:"NDKENV_JNILIBS" value-name:"LIB" description:"After the command succeeds, copy the built library LIB, e.g. build/{abi}/libfoo.so, into the jniLibs folder of the surrounding React Native, Flutter or Android project"`
 }
 
 func main() {
-	parser := flags.NewParser(&opts, flags.Default|flags.IgnoreUnknown)
-	parser.Usage = "[-a abi] [-s sdk version] command\nExample:\n  ndkenv -a arm64-v8a -s 21 -- go build ."
+	// Errors are printed below, so that errors from commands are printed as fatal
+	// Everything from the first argument that isn't an option (or a command) is
+	// the command to run, so its own flags don't need to be separated with --
+	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash|flags.PassAfterNonOption)
+	parser.Usage = "[-a abi] [-s sdk version]"
 	parser.LongDescription = description
 
+	parser.SubcommandsOptional = true
+	parser.AddCommand("info", "Print details of the NDK toolchain in use",
+		"Prints the NDK version, clang and lld versions, host tag and sysroot of the NDK in use, and the API levels it supports for each ABI, for bug reports and CI provenance records, e.g. ndkenv info --format json",
+		&infoCommand{})
+	parser.AddCommand("nix", "Print a Nix shell for the target",
+		"Prints a shell.nix that provides the NDK from nixpkgs' androidenv and exports the same environment as ndkenv, e.g. ndkenv nix -a arm64-v8a -s 21 > shell.nix",
+		&nixCommand{})
+	parser.AddCommand("use", "Save options as the project defaults",
+		"Writes the given options to .ndkenv.toml, and the exact NDK version they resolve to to .ndkenv.lock, so they needn't be passed again, e.g. ndkenv use -a arm64-v8a -s 26 --ndk-version 26.1.*",
+		&useCommand{})
+	parser.AddCommand("buck2", "Print Buck2 C++ toolchains for the targets",
+		"Prints a system_cxx_toolchain for each --abi, using the NDK's clang with the same flags as ndkenv, for adding to a Buck2 toolchains cell, e.g. ndkenv -a arm64-v8a -a x86-64 -s 21 buck2 >> toolchains/BUCK",
+		&buck2Command{})
+	parser.AddCommand("init-docker", "Write a Dockerfile for reproducible builds",
+		"Writes a Dockerfile that pins the Go version, NDK version and ndkenv invocation currently in effect, so release builds can be run in a container, e.g. ndkenv init-docker --compose go build -o libfoo.so .",
+		&initDockerCommand{})
+	parser.AddCommand("apk", "Package a Go program into an installable APK",
+		"Builds a Go package with -buildmode=c-shared and packages it as a NativeActivity in a minimal APK signed with the debug keystore, using the SDK's build-tools. The package must export ANativeActivity_onCreate, e.g. by using golang.org/x/mobile/app",
+		&apkCommand{})
+	parser.AddCommand("init-android", "Write a minimal Android project that loads the Go library",
+		"Writes a Gradle project to android/ with an app that loads a Go library from jniLibs, ready for ndkenv --jnilibs to copy builds into, e.g. ndkenv -a arm64-v8a -s 21 init-android libfoo.so",
+		&initAndroidCommand{})
+	parser.AddCommand("init-devcontainer", "Write a dev container feature for the project",
+		"Writes a dev container feature to .devcontainer/ndkenv that installs the NDK version and ndkenv currently in use, and sets the environment ndkenv would, so Codespaces and dev containers can build for Android from the start",
+		&initDevcontainerCommand{})
+	parser.AddCommand("direnv", "Write the environment to .envrc for direnv",
+		"Writes the environment for the target to a block of .envrc, replacing the block if it's already there and leaving the rest of the file alone, so direnv sets it on entering the project directory, e.g. ndkenv -a arm64-v8a -s 21 direnv",
+		&direnvCommand{})
+	parser.AddCommand("doctor", "Check that everything needed to build is in place",
+		"Checks each step of building for Android with cgo in turn: locating the NDK, its clang and sysroot headers for each ABI (every ABI unless -a is given), the min SDK version being in the NDK's range, and the Go toolchain supporting android/GOARCH with cgo enabled, printing a fix for each check that fails, e.g. ndkenv doctor",
+		&doctorCommand{})
+	parser.AddCommand("env", "Print the environment as shell commands",
+		"Prints a command setting each of the variables ndkenv sets, for bash and zsh by default or the --shell given, with --github to $GITHUB_ENV for later steps of a GitHub Actions job, or with --format json as a JSON object that also has the paths of the NDK, clang and sysroot. Shell commands let several commands be run in the same shell, e.g. eval \"$(ndkenv -a arm64-v8a -s 21 env)\"",
+		&envCommand{})
+	parser.AddCommand("generate", "Run go generate with the target's environment",
+		"Runs go generate (on ./... by default) with the same environment as a build, so generators that look at GOOS, GOARCH or build tags, or run the C toolchain, see the real target, e.g. ndkenv -a arm64-v8a -s 21 generate --run stringer ./...",
+		&generateCommand{})
+	parser.AddCommand("install-ndk", "Download an NDK into the SDK",
+		"Downloads the newest NDK release matching VERSION from Google's SDK repository, verifies its published checksum and unpacks it into the SDK's ndk folder, where ndkenv looks for NDKs, so machines don't need Android Studio or sdkmanager, e.g. ndkenv install-ndk 26.1.10909125",
+		&installNDKCommand{})
+	parser.AddCommand("list-abis", "List the ABIs of the NDK and how ndkenv maps them",
+		"Lists the ABIs of the NDK in use, from its meta/abis.json where it has one, with the name to pass to --abi, the clang triple, and the GOARCH and GOARM ndkenv builds with, e.g. ndkenv list-abis --format json",
+		&listABIsCommand{})
+	parser.AddCommand("list-ndks", "List the NDKs ndkenv can find",
+		"Lists every NDK found in local.properties, $ANDROID_NDK_HOME and the like, and the SDK's ndk folder, with its version, the ABIs it has sysroots for and the API levels it supports, marking the one ndkenv would use with *, e.g. ndkenv list-ndks --ndk-version 26",
+		&listNDKsCommand{})
+	parser.AddCommand("which", "Print the paths of the NDK's toolchain",
+		"Prints the paths of the NDK, toolchain, clang, sysroot, arch-specific include dir and Android libraries ndkenv builds the target with, or with NAME just the one named (or the path of a binary in the toolchain), for debugging header and link problems and pointing other tools at the same paths, e.g. ndkenv -a arm64-v8a -s 21 which llvm-strip",
+		&whichCommand{})
+	parser.AddCommand("print-var", "Print the value of a single variable",
+		"Prints just the value of one of the variables ndkenv sets, for use in Makefiles and scripts, e.g. CC := $(shell ndkenv -a arm64-v8a -s 21 print-var CC)",
+		&printVarCommand{})
+	parser.AddCommand("requirements", "Print the sdkmanager packages needed to build",
+		"Prints the sdkmanager package for the NDK version in use, one per line, and with --apk the platform and build-tools used by ndkenv apk, for provisioning CI images, e.g. sdkmanager $(ndkenv requirements --apk)",
+		&requirementsCommand{})
+	parser.AddCommand("serve", "Serve the environment of targets over HTTP",
+		"Serves the environment for a target as JSON from GET /env?abi=...&api=..., also taking profile and ndk-version, with the options given to ndkenv as defaults. Each distinct request is resolved once while the project config is unchanged, so editors and build daemons can query it repeatedly",
+		&serveCommand{})
+	parser.AddCommand("shell", "Start a shell with the target's environment",
+		"Starts $SHELL with the environment for the target, and its prompt prefixed with the ABI, e.g. (ndk:arm64-v8a), so go build, go vet and the like can be run without going through ndkenv each time. NDKENV_SHELL is set to the ABI, for prompts that don't use PS1",
+		&shellCommand{})
+	parser.AddCommand("toolexec", "Run a Go tool, logging and timing it, for go build -toolexec",
+		"Runs the compile, link or other Go tool that go build passes it, optionally logging each invocation with how long it took and the GOOS and GOARCH it ran with, e.g. ndkenv -a arm64-v8a -s 21 go build -toolexec \"ndkenv toolexec --log tools.jsonl\" .",
+		&toolexecCommand{})
+	parser.AddCommand("triple", "Print the clang target triple for the target",
+		"Prints the target triple ndkenv maps the ABI to, one line per --abi, for configuring other cross tools, e.g. ndkenv -a armeabi-v7a -s 24 triple --api",
+		&tripleCommand{})
+
+	// NDKENV_MIN_SDK is accepted as a shorter name for NDKENV_MIN_SDK_VERSION
+	if _, ok := os.LookupEnv("NDKENV_MIN_SDK_VERSION"); !ok {
+		if api, ok := os.LookupEnv("NDKENV_MIN_SDK"); ok {
+			os.Setenv("NDKENV_MIN_SDK_VERSION", api)
+		}
+	}
+
 	leftoverArgs, err := parser.Parse()
 	if err != nil {
+		var flagsErr *flags.Error
+		switch {
+		case errors.As(err, &flagsErr) && flagsErr.Type == flags.ErrHelp:
+			fmt.Println(err)
+		case errors.As(err, &flagsErr):
+			fmt.Fprintln(os.Stderr, err)
+		default:
+			fatalf("%s", err)
+		}
 		os.Exit(1)
 	}
-	if len(leftoverArgs) == 0 {
-		parser.WriteHelp(os.Stdout)
-		os.Exit(1)
+	if parser.Active != nil {
+		os.Exit(0)
 	}
-
-	if opts.NDK == "" {
-		opts.NDK, err = findNDK(opts.MinSDKVersion)
+	if len(leftoverArgs) == 0 && opts.WriteEnv == "" {
+		projectCfg, _, err := loadProject()
+		if err != nil {
+			fatalf("%s", err)
+			os.Exit(1)
+		}
+		if projectCfg.Command == "" {
+			parser.WriteHelp(os.Stdout)
+			os.Exit(1)
+		}
+		// Validated when the config was loaded
+		leftoverArgs, _ = splitArgs(projectCfg.Command)
+	}
+	// A command of - means read the command from stdin, so it can be templated
+	// by other tools without needing to be quoted for a shell
+	if len(leftoverArgs) == 1 && leftoverArgs[0] == "-" {
+		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			fmt.Printf("Fatal: Automatically locating NDK: %s\n", err)
+			fatalf("reading command from stdin: %s", err)
+			os.Exit(1)
+		}
+		if leftoverArgs, err = splitArgs(string(data)); err != nil {
+			fatalf("reading command from stdin: %s", err)
+			os.Exit(1)
+		}
+		if len(leftoverArgs) == 0 {
+			fatalf("reading command from stdin: no command given")
+			os.Exit(1)
+		}
+	}
+
+	if opts.Host {
+		if len(opts.ABIs) > 0 {
+			fatalf("--host can't be used with --abi, pass -a host alongside the other ABIs instead")
+			os.Exit(1)
+		}
+		opts.ABIs = []string{hostABI}
+	}
+	if opts.WriteEnv != "" {
+		if err = writeEnvFiles(); err != nil {
+			fatalf("--write-env: %s", err)
 			os.Exit(1)
 		}
+		if len(leftoverArgs) == 0 {
+			os.Exit(0)
+		}
+	}
+	if leftoverArgs, err = expandCommand(leftoverArgs); err != nil {
+		fatalf("%s", err)
+		os.Exit(1)
+	}
+
+	if opts.Dist != "" {
+		dist = &distArchive{path: opts.Dist}
+	}
+	if opts.Metrics != "" {
+		metrics = &buildMetrics{path: opts.Metrics}
 	}
 
-	var cfg abiCfg
-	cfg, err = buildCfg(opts.ABI)
+	// Run the command once for each ABI, stopping at the first failure
+	err = forEachABI(func(spec string) error {
+		if metrics != nil {
+			metrics.begin()
+		}
+		code := runABI(spec, leftoverArgs)
+		debugf("Exited with %d", code)
+		if metrics != nil {
+			metrics.finish(code)
+		}
+		if code != 0 {
+			// Failed builds are worth tracking too
+			if metrics != nil {
+				if err := metrics.write(); err != nil {
+					warnf("--metrics: %s", err)
+				}
+			}
+			os.Exit(code)
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("Fatal: %s", err)
+		fatalf("%s", err)
 		os.Exit(1)
 	}
+	if metrics != nil {
+		if err = metrics.write(); err != nil {
+			fatalf("--metrics: %s", err)
+			os.Exit(1)
+		}
+	}
+	if dist != nil {
+		if err = dist.write(); err != nil {
+			fatalf("--dist: %s", err)
+			os.Exit(1)
+		}
+		infof("Wrote %s", dist.path)
+	}
+	os.Exit(0)
+}
 
-	// NDK currently only supports x86_64
-	// https://developer.android.com/ndk/guides/other_build_systems
-	ndkOS := fmt.Sprintf("%s-x86_64", runtime.GOOS)
+// Collects the library built for each ABI, with --dist
+var dist *distArchive
 
-	toolchain := filepath.Join(opts.NDK, "toolchains", "llvm", "prebuilt", ndkOS)
-	sysroot := filepath.Join(toolchain, "sysroot")
-	iSystem := filepath.Join(sysroot, "usr", "include", cfg.triple)
-	clang := filepath.Join(toolchain, "bin", "clang")
+// Collects metrics of the build for each ABI, with --metrics
+var metrics *buildMetrics
 
-	GOARCH := fmt.Sprintf("GOARCH=%s", cfg.GOARCH)
-	GOARM := fmt.Sprintf("GOARM=%s", cfg.GOARM)
-	CC := fmt.Sprintf("CC=%s -target %s%d --sysroot=%s",
-		clang, cfg.target, opts.MinSDKVersion, sysroot)
-	CGO_CFLAGS := fmt.Sprintf("CGO_CFLAGS=-isystem %s/ %s", iSystem, os.Getenv("CGO_CFLAGS"))
+// runABI runs the command for the ABI forEachABI selected from spec, saying
+// which when running for several
+func runABI(spec string, args []string) int {
+	if len(abiSpecs()) > 1 {
+		infof("Running for %s", spec)
+	}
+	return run(args)
+}
 
-	newEnv := []string{"CGO_ENABLED=1", "GOOS=android", GOARCH, GOARM, CC, CGO_CFLAGS}
-	if opts.Verbose {
-		fmt.Printf("Using env:\n%s\n", strings.Join(newEnv, "\n"))
+// run runs the command for the ABI selected in opts, returning its exit code
+func run(args []string) int {
+	if opts.ABI == hostABI {
+		return runHost(args)
+	}
+	t, err := resolve()
+	if err != nil {
+		fatalf("%s", err)
+		return 1
+	}
+	args = t.expandArgs(args)
+	var artifact string
+	if dist != nil || opts.IfChanged {
+		if artifact, err = builtArtifact(t, args); err != nil {
+			fatalf("%s", err)
+			return 1
+		}
+	}
+	if metrics != nil {
+		m := metrics.current()
+		m.ABI, m.MinSDKVersion = t.Name, t.api
+		m.NDKVersion, _ = ndkVersion(t.ndk)
+		// The artifact is optional, just for its size
+		if artifact != "" {
+			m.Artifact = artifact
+		} else {
+			m.Artifact, _ = builtArtifact(t, args)
+		}
+	}
+	if err = t.check(); err != nil {
+		fatalf("%s", err)
+		return 1
+	}
+	newEnv := t.env(inheritedGetenv)
+	if opts.PrependPath {
+		newEnv = append(newEnv, t.pathEnv())
+	}
+	if opts.RespectEnv != "" {
+		newEnv = respectEnv(newEnv, strings.Split(opts.RespectEnv, ","))
+	}
+	if err = checkConflicts(newEnv); err != nil {
+		fatalf("%s", err)
+		return 1
+	}
+	if opts.Sandbox != "" {
+		sandbox, err := sandboxEnv(t.expand(opts.Sandbox))
+		if err != nil {
+			fatalf("--sandbox: %s", err)
+			return 1
+		}
+		newEnv = append(newEnv, sandbox...)
+	}
+	if opts.BuildVCS != "" {
+		newEnv = append(newEnv, buildVCSEnv(opts.BuildVCS))
+	}
+	if opts.Stamp {
+		if args, err = stampArgs(args, t); err != nil {
+			fatalf("%s", err)
+			return 1
+		}
+	}
+
+	// Fail up front if the Go toolchain that go.mod or GOTOOLCHAIN selects
+	// can't build for android, rather than partway through the build
+	if opts.PinGoToolchain || isGoCommand(args) {
+		tc, err := selectGoToolchain(t, commandEnv(newEnv))
+		if err != nil {
+			fatalf("%s", err)
+			return 1
+		}
+		verbosef("Using Go toolchain %s (%s)", tc.version, tc.source())
+		if !opts.NoCompatCheck {
+			version, _ := ndkVersion(t.ndk)
+			for _, warning := range compatWarnings(tc.version, version, t) {
+				warnf("%s, pass --no-compat-check to silence this", warning)
+			}
+		}
+		if opts.PinGoToolchain {
+			newEnv = append(newEnv, "GOTOOLCHAIN="+tc.pin())
+		}
+	}
+	verbosef("Using env:\n%s", strings.Join(newEnv, "\n"))
+	var inputs buildInputs
+	if opts.IfChanged {
+		if inputs, err = hashInputs(t, args, newEnv, artifact); err != nil {
+			fatalf("--if-changed: %s", err)
+			return 1
+		}
+		if inputs.upToDate(artifact) {
+			infof("%s is up to date for %s, skipping", artifact, t.Name)
+			if metrics != nil {
+				metrics.current().Skipped = true
+			}
+			if dist != nil {
+				if err = dist.add(t, artifact); err != nil {
+					fatalf("--dist: %s", err)
+					return 1
+				}
+			}
+			return 0
+		}
+	}
+	if opts.Sandbox != "" && isGoCommand(args) {
+		dir, _ := filepath.Abs(t.expand(opts.Sandbox))
+		if err = populateSandbox(dir, commandEnv(newEnv)); err != nil {
+			fatalf("--sandbox: %s", err)
+			return 1
+		}
+	}
+	if t.outDir != "" {
+		if err = os.MkdirAll(t.expand(t.outDir), 0755); err != nil {
+			fatalf("creating out_dir: %s", err)
+			return 1
+		}
+	}
+
+	// Locate the project up front, rather than finding out after a long build
+	var project androidProject
+	if opts.JNILibs != "" || t.postBuild.needsProject() {
+		wd, _ := os.Getwd()
+		if project, err = findAndroidProject(wd); err != nil {
+			fatalf("copying to jniLibs: %s", err)
+			return 1
+		}
 	}
 
-	cmd := exec.Command(leftoverArgs[0], leftoverArgs[1:]...)
-	cmd.Env = append(os.Environ(), newEnv...)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+	var tracer *toolchainTracer
+	if opts.TraceToolchain != "" {
+		if args, err = traceArgs(args); err != nil {
+			fatalf("%s", err)
+			return 1
+		}
+		if tracer, err = newToolchainTracer(t.expand(opts.TraceToolchain), t); err != nil {
+			fatalf("--trace-toolchain: %s", err)
+			return 1
+		}
+	}
+
+	var report *junitReport
+	if opts.JUnit != "" {
+		if err = junitArgs(args); err != nil {
+			fatalf("%s", err)
+			return 1
+		}
+		report = newJUnitReport(t.expand(opts.JUnit), t)
+	}
+
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	var tee *os.File
+	if opts.Tee != "" {
+		if tee, err = os.Create(t.expand(opts.Tee)); err != nil {
+			fatalf("--tee: %s", err)
+			return 1
+		}
+		shared := &syncWriter{w: tee}
+		stdout, stderr = io.MultiWriter(stdout, shared), io.MultiWriter(stderr, shared)
+	}
+	if opts.Timestamps {
+		start := time.Now()
+		stdout, stderr = &timestamper{w: stdout, start: start}, &timestamper{w: stderr, start: start}
+	}
+
+	if metrics != nil && isGoCommand(args) && len(args) > 1 && (args[1] == "build" || args[1] == "install") {
+		m := metrics.current()
+		if m.Packages, m.CachedPackages, err = goCacheStats(args, commandEnv(newEnv)); err != nil {
+			warnf("--metrics: counting cached packages: %s", err)
+		} else if m.Packages > 0 {
+			ratio := float64(m.CachedPackages) / float64(m.Packages)
+			m.CacheHitRatio = &ratio
+		}
+	}
+
+	name := args[0]
+	// The command is looked up on ndkenv's own PATH, so look in the toolchain first
+	if opts.PrependPath && filepath.Base(name) == name {
+		if path, err := exec.LookPath(filepath.Join(t.toolchain, "bin", name)); err == nil {
+			name = path
+		}
+	}
+	cmd := exec.Command(name, args[1:]...)
+	cmd.Env = commandEnv(newEnv)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = stderr
+	cmd.Stdout = stdout
+	if report != nil {
+		cmd.Stdout = io.MultiWriter(stdout, report)
+	}
+	if tracer != nil {
+		// go build -x prints the commands it runs to stderr
+		cmd.Stderr = io.MultiWriter(stderr, tracer)
+	}
+	debugf("Running %q for %s with min SDK version %d", args, t.Name, t.api)
+	started := time.Now()
+	err = runForwardingSignals(cmd)
+	if metrics != nil {
+		metrics.current().CommandSeconds = time.Since(started).Seconds()
+	}
+	if tee != nil {
+		if closeErr := tee.Close(); closeErr != nil {
+			fatalf("--tee: %s", closeErr)
+			return 1
+		}
+	}
+	if tracer != nil {
+		if closeErr := tracer.Close(); closeErr != nil {
+			fatalf("--trace-toolchain: %s", closeErr)
+			return 1
+		}
+		tracer.summarize(os.Stderr)
+	}
+	// Failing tests are reported, rather than a reason not to write a report
+	if report != nil {
+		if closeErr := report.Close(); closeErr != nil {
+			fatalf("--junit: %s", closeErr)
+			return 1
+		}
+	}
+	if err != nil {
+		return commandExitCode(args[0], err)
+	}
+	if opts.JNILibs != "" {
+		if err = installJNILib(project, t.ABI, t.expand(opts.JNILibs)); err != nil {
+			fatalf("--jnilibs: %s", err)
+			return 1
+		}
+	}
+	if t.postBuild != nil {
+		if err = t.postBuild.run(t, project); err != nil {
+			fatalf("%s", err)
+			return 1
+		}
+	}
+	if opts.IfChanged {
+		if err = inputs.record(); err != nil {
+			fatalf("--if-changed: %s", err)
+			return 1
+		}
+	}
+	if dist != nil {
+		if err = dist.add(t, artifact); err != nil {
+			fatalf("--dist: %s", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// commandExitCode returns the exit code to exit with when running the command
+// failed with err. When it couldn't be run at all, that's reported and, as with
+// shells, the exit code is 127 if it wasn't found or 126 if it isn't executable.
+func commandExitCode(name string, err error) int {
 	var exitError *exec.ExitError
-	if err = cmd.Run(); errors.As(err, &exitError) {
-		os.Exit(exitError.ExitCode())
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	fatalf("running %s: %s", name, err)
+	if metrics != nil {
+		metrics.current().Error = err.Error()
+	}
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return 127
+	case errors.Is(err, os.ErrPermission), errors.Is(err, syscall.ENOEXEC):
+		return 126
+	default:
+		return 1
 	}
-	os.Exit(0)
+}
+
+// withExisting returns flags followed by any flags the caller already had set
+// in the environment.
+func withExisting(flags []string, existing string) []string {
+	if existing != "" {
+		flags = append(flags[:len(flags):len(flags)], existing)
+	}
+	return flags
 }
 
 func defaultSdkFolder() string {
@@ -103,58 +595,327 @@ func defaultSdkFolder() string {
 	}
 }
 
-func findNDK(minSdkVersion int) (string, error) {
-	// Look for an NDK containing folder in the default Android Studio location
-	ndkFolder := filepath.Join(defaultSdkFolder(), "ndk")
+// androidSDKFolder returns the Android SDK that the surrounding Gradle project's
+// local.properties uses, or else the one set by ANDROID_HOME (or the older
+// ANDROID_SDK_ROOT), or else the default Android Studio location
+func androidSDKFolder() string {
+	if sdk := localProperty("sdk.dir"); sdk != "" {
+		explain("using the SDK at %s, from sdk.dir in local.properties", sdk)
+		return sdk
+	}
+	for _, name := range []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		if sdk := os.Getenv(name); sdk != "" {
+			explain("using the SDK at %s, from $%s", sdk, name)
+			return sdk
+		}
+		explain("$%s isn't set", name)
+	}
+	explain("using the SDK at %s, Android Studio's default location", defaultSdkFolder())
+	return defaultSdkFolder()
+}
+
+// Variables that CI images and Gradle use for the path of a single NDK, in the
+// order they're checked
+var ndkEnvVars = []string{"ANDROID_NDK_HOME", "ANDROID_NDK_ROOT", "ANDROID_NDK"}
+
+// findNDK returns the installed NDK matching version (or any NDK, if version is
+// ""), using --ndk-policy to choose between several in the SDK and searchPaths
+func findNDK(version string, searchPaths []string) (string, error) {
+	for _, source := range ndkSources() {
+		v, err := ndkVersion(source.dir)
+		if err != nil {
+			warnf("ignoring %s, %s isn't an NDK", source.name, source.dir)
+			continue
+		}
+		if (version == "" || matchVersion(version, v)) && inChannel(v, version) {
+			verbosef("Using NDK %s from %s", v, source.name)
+			explain("using NDK %s at %s, from %s", v, source.dir, source.name)
+			return source.dir, nil
+		}
+		verbosef("Skipping NDK %s from %s, it doesn't match version %s", v, source.name, version)
+		explain("skipping NDK %s at %s, from %s: %s", v, source.dir, source.name, whyNotMatched(v, version))
+	}
+
+	// Look for an NDK containing folder in the SDK, then the search paths
+	ndkFolder := filepath.Join(androidSDKFolder(), "ndk")
+	installed, err := sdkNDKs(ndkFolder)
+	if err != nil {
+		if len(searchPaths) == 0 {
+			return "", err
+		}
+		explain("%s", err)
+	}
+	installed = addNDKs(installed, searchPathNDKs(searchPaths))
+	places := strings.Join(append([]string{ndkFolder}, searchPaths...), ", ")
+	var candidates []sdkNDK
+	for _, ndk := range installed {
+		if (version == "" || matchVersion(version, ndk.version)) && inChannel(ndk.version, version) {
+			explain("NDK %s at %s matches", ndk.version, ndk.dir)
+			candidates = append(candidates, ndk)
+		} else {
+			explain("skipping NDK %s at %s: %s", ndk.version, ndk.dir, whyNotMatched(ndk.version, version))
+		}
+	}
+	if len(candidates) == 0 {
+		if version == "" {
+			return "", fmt.Errorf("no %s NDKs installed in %s", opts.Channel, places)
+		}
+		return "", fmt.Errorf("no %s NDK matching version %s in %s", opts.Channel, version, places)
+	}
+	versions := make([]string, len(candidates))
+	for i, c := range candidates {
+		versions[i] = c.version
+	}
+
+	var chosen sdkNDK
+	switch opts.NDKPolicy {
+	case "newest":
+		chosen = candidates[len(candidates)-1]
+	case "oldest":
+		chosen = candidates[0]
+	case "error":
+		if len(candidates) > 1 {
+			return "", fmt.Errorf("several NDKs in %s match, pass --ndk-version to pick one of: %s",
+				places, strings.Join(versions, ", "))
+		}
+		chosen = candidates[0]
+	}
+	verbosef("Considered NDKs: %s\nUsing NDK %s (--ndk-policy %s)", strings.Join(versions, ", "), chosen.version, opts.NDKPolicy)
+	explain("using NDK %s at %s (--ndk-policy %s)", chosen.version, chosen.dir, opts.NDKPolicy)
+	return chosen.dir, nil
+}
+
+// ndkSource is an NDK set outside of the SDK's ndk folder, named after where
+// it was set
+type ndkSource struct{ name, dir string }
+
+// ndkSources returns the NDKs set by the Gradle project, as Gradle would use
+// them, then by the environment, in the order findNDK tries them
+func ndkSources() []ndkSource {
+	var sources []ndkSource
+	if dir := localProperty("ndk.dir"); dir != "" {
+		sources = append(sources, ndkSource{"ndk.dir in local.properties", dir})
+	}
+	for _, name := range ndkEnvVars {
+		if dir := os.Getenv(name); dir != "" {
+			sources = append(sources, ndkSource{"$" + name, dir})
+		} else {
+			explain("$%s isn't set", name)
+		}
+	}
+	return sources
+}
+
+// sdkNDK is an NDK installed side by side in the SDK's ndk folder, or found
+// in a search path
+type sdkNDK struct{ dir, version string }
+
+// sdkNDKs returns the NDKs in ndkFolder, oldest first
+func sdkNDKs(ndkFolder string) ([]sdkNDK, error) {
 	entries, err := os.ReadDir(ndkFolder)
 	if err != nil {
-		return "", fmt.Errorf("listing %s: %w", ndkFolder, err)
+		return nil, fmt.Errorf("listing %s: %w", ndkFolder, err)
 	}
-	// Return the first NDK that matches the minSdkVersion, e.g. 21.4.7075529 for "21"
+	// Folders are usually named after the version, but pre-releases are only
+	// identified as such by their source.properties
+	var ndks []sdkNDK
 	for _, entry := range entries {
-		if entry.IsDir() && strings.HasPrefix(entry.Name(), strconv.Itoa(minSdkVersion)) {
-			return filepath.Join(ndkFolder, entry.Name()), nil
-		}
-	}
-	return "", os.ErrNotExist
-}
-
-type abiCfg struct {
-	target string
-	triple string
-	GOARCH string
-	GOARM  string
-}
-
-//http://android-doc.github.io/ndk/guides/standalone_toolchain.html
-func buildCfg(abi string) (abiCfg, error) {
-	switch abi {
-	case "armeabi-v7a":
-		return abiCfg{
-			target: "armv7-none-linux-androideabi",
-			triple: "armv7a-linux-androideabi",
-			GOARCH: "arm",
-			GOARM:  "7",
-		}, nil
-	case "arm64-v8a":
-		return abiCfg{
-			target: "aarch64-none-linux-android",
-			triple: "aarch64-linux-android",
-			GOARCH: "arm64",
-		}, nil
-	case "x86":
-		return abiCfg{
-			target: "i686-none-linux-android",
-			triple: "i686-linux-android",
-			GOARCH: "386",
-		}, nil
-	case "x86-64":
-		return abiCfg{
-			target: "x86_64-none-linux-android",
-			triple: "x86_64-linux-android",
-			GOARCH: "amd64",
-		}, nil
+		if !entry.IsDir() {
+			continue
+		}
+		v, err := ndkVersion(filepath.Join(ndkFolder, entry.Name()))
+		if err != nil {
+			v = entry.Name()
+		}
+		ndks = append(ndks, sdkNDK{filepath.Join(ndkFolder, entry.Name()), v})
+	}
+	sort.Slice(ndks, func(i, j int) bool { return compareVersions(ndks[i].version, ndks[j].version) < 0 })
+	return ndks, nil
+}
+
+// searchPathNDKs returns the NDKs in dirs, each of which is either an NDK or a
+// folder of them. Unlike in the SDK's ndk folder, anything without a
+// source.properties is left out, as the folder may hold more than NDKs
+func searchPathNDKs(dirs []string) []sdkNDK {
+	var ndks []sdkNDK
+	for _, dir := range dirs {
+		if v, err := ndkVersion(dir); err == nil {
+			explain("found NDK %s at %s, a search path", v, dir)
+			ndks = append(ndks, sdkNDK{dir, v})
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Configs may list where each platform's package manager puts it
+			explain("skipping search path %s: %s", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if v, err := ndkVersion(path); err == nil {
+				ndks = append(ndks, sdkNDK{path, v})
+			}
+		}
+	}
+	return ndks
+}
+
+// addNDKs adds the NDKs in more to ndks, leaving out any already there (such as
+// when a search path is the SDK's ndk folder), oldest first
+func addNDKs(ndks, more []sdkNDK) []sdkNDK {
+	for _, ndk := range more {
+		found := false
+		for _, n := range ndks {
+			found = found || sameFile(n.dir, ndk.dir)
+		}
+		if !found {
+			ndks = append(ndks, ndk)
+		}
+	}
+	sort.SliceStable(ndks, func(i, j int) bool { return compareVersions(ndks[i].version, ndks[j].version) < 0 })
+	return ndks
+}
+
+// Matches an NDK release name, e.g. r26 or r26b, whose letter is the minor version
+var ndkReleasePattern = regexp.MustCompile(`^r(\d+)([a-z]?)$`)
+
+// matchVersion reports whether version matches pattern, which is either a glob
+// such as 26.1.* (or 26.1.x), a version prefix such as 26 or 26.1, a release
+// name such as r26b, or comma-separated constraints such as >=25,<27
+func matchVersion(pattern, version string) bool {
+	if strings.ContainsAny(pattern, "<>=,") {
+		for _, constraint := range strings.Split(pattern, ",") {
+			if !matchConstraint(strings.TrimSpace(constraint), version) {
+				return false
+			}
+		}
+		return true
+	}
+	// As in ndkReleaseName, r26 is 26.0 and r26b is 26.1
+	if m := ndkReleasePattern.FindStringSubmatch(pattern); m != nil {
+		minor := 0
+		if m[2] != "" {
+			minor = int(m[2][0] - 'a')
+		}
+		pattern = m[1] + "." + strconv.Itoa(minor)
+	}
+	parts := strings.Split(pattern, ".")
+	for i, part := range parts {
+		if part == "x" {
+			parts[i] = "*"
+		} else if strings.HasPrefix(part, "x-") {
+			parts[i] = "*" + part[1:]
+		}
+	}
+	pattern = strings.Join(parts, ".")
+	if ok, _ := path.Match(pattern, version); ok {
+		return true
+	}
+	return strings.HasPrefix(version, pattern+".")
+}
+
+// matchConstraint reports whether version satisfies a constraint such as >=25
+// or <27. Versions are compared numerically, so 26.1 is >26 and <27.
+func matchConstraint(constraint, version string) bool {
+	for _, op := range []string{">=", "<=", "==", ">", "<", "="} {
+		if !strings.HasPrefix(constraint, op) {
+			continue
+		}
+		c := compareVersions(version, strings.TrimSpace(constraint[len(op):]))
+		switch op {
+		case ">=":
+			return c >= 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case "<":
+			return c < 0
+		default:
+			return c == 0
+		}
+	}
+	return matchVersion(constraint, version)
+}
+
+// preRelease returns the pre-release part of a version such as 27.0.11718014-beta1,
+// or "" for stable versions. Some NDKs separate it with a space instead.
+func preRelease(version string) string {
+	if i := strings.IndexAny(version, "- "); i >= 0 {
+		return strings.TrimSpace(version[i+1:])
+	}
+	return ""
+}
+
+// inChannel reports whether an NDK version is on the release channel selected
+// with --channel. Pre-releases are also allowed if the requested version
+// names one explicitly.
+func inChannel(version, requested string) bool {
+	switch {
+	case preRelease(version) == "":
+		return true
+	case opts.Channel == "canary":
+		return true
+	case opts.Channel == "beta":
+		pre := preRelease(version)
+		return strings.HasPrefix(pre, "beta") || strings.HasPrefix(pre, "rc")
 	default:
-		return abiCfg{}, fmt.Errorf("unknown abi: %s", abi)
+		return preRelease(requested) != ""
+	}
+}
+
+// compareVersions compares dot-separated versions numerically, returning
+// -1, 0 or 1 if a is older than, the same as or newer than b. Pre-releases are
+// older than the release they precede, with betas before release candidates.
+func compareVersions(a, b string) int {
+	aPre, bPre := preRelease(a), preRelease(b)
+	if i := strings.IndexAny(a, "- "); i >= 0 {
+		a = a[:i]
+	}
+	if i := strings.IndexAny(b, "- "); i >= 0 {
+		b = b[:i]
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		// e.g. beta1 < beta2 < rc1
+		return -1
+	default:
+		return 1
+	}
+}
+
+// ndkVersion returns the version of the NDK at path, e.g. 26.1.10909125
+func ndkVersion(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(path, "source.properties"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok && strings.TrimSpace(key) == "Pkg.Revision" {
+			return strings.TrimSpace(value), nil
+		}
 	}
+	return "", fmt.Errorf("no Pkg.Revision in %s", filepath.Join(path, "source.properties"))
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// buildMetrics collects how the build went for each ABI, with --metrics, to be
+// written once every ABI has been built (or one has failed)
+type buildMetrics struct {
+	path   string
+	builds []*buildMetric
+}
+
+type buildMetric struct {
+	ABI             string   `json:"abi"`
+	MinSDKVersion   int      `json:"min_sdk_version,omitempty"`
+	NDKVersion      string   `json:"ndk_version,omitempty"`
+	ExitCode        int      `json:"exit_code"`
+	Error           string   `json:"error,omitempty"`   // Why the command couldn't be run, e.g. it wasn't found
+	Skipped         bool     `json:"skipped,omitempty"` // Up to date, with --if-changed
+	DurationSeconds float64  `json:"duration_seconds"`
+	CommandSeconds  float64  `json:"command_seconds"` // Just the command, without ndkenv's checks and post-build steps
+	Packages        int      `json:"packages,omitempty"`
+	CachedPackages  int      `json:"cached_packages,omitempty"`
+	CacheHitRatio   *float64 `json:"cache_hit_ratio,omitempty"` // Only for go build and install
+	Artifact        string   `json:"artifact,omitempty"`
+	ArtifactBytes   int64    `json:"artifact_bytes,omitempty"`
+
+	start time.Time
+}
+
+// begin starts timing the build for the next ABI
+func (m *buildMetrics) begin() {
+	m.builds = append(m.builds, &buildMetric{start: time.Now()})
+}
+
+// current returns the metrics of the ABI being built
+func (m *buildMetrics) current() *buildMetric {
+	return m.builds[len(m.builds)-1]
+}
+
+// finish records the exit code of the ABI being built, and the size of its artifact
+func (m *buildMetrics) finish(code int) {
+	b := m.current()
+	b.ExitCode = code
+	b.DurationSeconds = time.Since(b.start).Seconds()
+	if b.Artifact != "" {
+		if info, err := os.Stat(b.Artifact); err == nil {
+			b.ArtifactBytes = info.Size()
+		}
+	}
+}
+
+func (m *buildMetrics) write() error {
+	data, err := json.MarshalIndent(struct {
+		CreatedBy string         `json:"created_by"`
+		Time      time.Time      `json:"time"`
+		Builds    []*buildMetric `json:"builds"`
+	}{createdBy(), time.Now(), m.builds}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, append(data, '\n'), 0644)
+}
+
+// goCacheStats counts the packages a go build or install command builds, and
+// how many of them are already in the build cache
+func goCacheStats(args []string, env []string) (packages, cached int, err error) {
+	// go list takes the same build flags, apart from -o, and -json means something else
+	listArgs := []string{"list", "-deps", "-f", "{{.Stale}}"}
+	for i := 2; i < len(args); i++ {
+		switch {
+		case args[i] == "-o" || args[i] == "--o":
+			i++
+		case strings.HasPrefix(args[i], "-o=") || strings.HasPrefix(args[i], "--o=") ||
+			args[i] == "-json" || args[i] == "--json":
+		default:
+			listArgs = append(listArgs, args[i])
+		}
+	}
+	out, err := goOutput(env, listArgs...)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, stale := range strings.Fields(out) {
+		packages++
+		if stale == "false" {
+			cached++
+		}
+	}
+	return packages, cached, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NDK archives are extracted into a cache shared by every project, keyed by
+// the hash of the archive, so projects pinning the same NDK share one copy.
+//
+//	ndk/<sha256>/          An extracted NDK
+//	ndk/<sha256>/.ndkenv-used  Touched whenever the NDK is used, for garbage collection
+//	archives/<sha256 of path>  Memoized hash of an archive, so it isn't rehashed on every run
+//	discovery/<sha256 of query>  Memoized NDK found by findNDK, see findNDKCached
+
+// Extracted NDKs that haven't been used for this long are removed
+const ndkCacheMaxAge = 60 * 24 * time.Hour
+
+const ndkUsedMarker = ".ndkenv-used"
+
+func ndkCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ndkenv"), nil
+}
+
+// cachedNDK returns the path of the NDK extracted from archive, extracting it
+// into the cache first if needed
+func cachedNDK(archive string) (string, error) {
+	cache, err := ndkCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash, err := archiveHash(cache, archive)
+	if err != nil {
+		return "", err
+	}
+	ndk := filepath.Join(cache, "ndk", hash)
+	if !isDir(ndk) {
+		if err = extractNDK(archive, ndk); err != nil {
+			return "", fmt.Errorf("extracting %s: %w", archive, err)
+		}
+		// A good time to reclaim space is when more is being used
+		if err = collectNDKCache(filepath.Join(cache, "ndk"), ndkCacheMaxAge); err != nil {
+			warnf("cleaning up NDK cache: %s", err)
+		}
+	}
+	now := time.Now()
+	if err = os.Chtimes(filepath.Join(ndk, ndkUsedMarker), now, now); err != nil {
+		return "", err
+	}
+	return ndk, nil
+}
+
+// archiveHash returns the sha256 of the file at path. Hashing an NDK takes a
+// while, so the result is memoized for as long as its size and mtime are unchanged.
+func archiveHash(cache, path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	pathHash := sha256.Sum256([]byte(path))
+	memo := filepath.Join(cache, "archives", hex.EncodeToString(pathHash[:]))
+	stamp := fmt.Sprintf("%d %d ", info.Size(), info.ModTime().UnixNano())
+	if data, err := os.ReadFile(memo); err == nil && strings.HasPrefix(string(data), stamp) {
+		return strings.TrimPrefix(string(data), stamp), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	// Failing to memoize only costs time on the next run
+	if err = os.MkdirAll(filepath.Dir(memo), 0755); err == nil {
+		_ = os.WriteFile(memo, []byte(stamp+hash), 0644)
+	}
+	return hash, nil
+}
+
+// extractNDK extracts the NDK in archive to dst. It's extracted alongside dst
+// and renamed into place, so a partial extraction is never mistaken for an NDK.
+func extractNDK(archive, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), ".extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err = unzip(archive, tmp); err != nil {
+		return err
+	}
+
+	// NDK releases contain a single folder, e.g. android-ndk-r26b
+	root := tmp
+	if !isFile(filepath.Join(root, "source.properties")) {
+		entries, err := os.ReadDir(tmp)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 1 || !isFile(filepath.Join(tmp, entries[0].Name(), "source.properties")) {
+			return fmt.Errorf("no source.properties found, is it an NDK?")
+		}
+		root = filepath.Join(tmp, entries[0].Name())
+	}
+	if err = os.WriteFile(filepath.Join(root, ndkUsedMarker), nil, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(root, dst); err != nil {
+		// Another ndkenv may have extracted the same archive in the meantime
+		if isDir(dst) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func unzip(archive, dst string) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// Entries are checked against where they really end up, through any
+	// symlinks already extracted
+	realDst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return err
+	}
+	// Symlinks are created last, so that no file is written through one
+	files := append([]*zip.File(nil), r.File...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Mode()&os.ModeSymlink == 0 && files[j].Mode()&os.ModeSymlink != 0
+	})
+	for _, f := range files {
+		path := filepath.Join(dst, f.Name)
+		if !strings.HasPrefix(path, dst+string(filepath.Separator)) {
+			return fmt.Errorf("%s: path escapes archive", f.Name)
+		}
+		parent, err := resolveExisting(filepath.Dir(path))
+		if err != nil || !within(parent, realDst) {
+			return fmt.Errorf("%s: path escapes archive through a symlink", f.Name)
+		}
+		if err = unzipFile(f, filepath.Join(parent, filepath.Base(path)), realDst); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// resolveExisting returns path with the symlinks in the part of it that
+// exists followed, so it's known where creating the rest would write to
+func resolveExisting(path string) (string, error) {
+	existing := path
+	for {
+		if _, err := os.Lstat(existing); err == nil || filepath.Dir(existing) == existing {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	rest, err := filepath.Rel(existing, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, rest), nil
+}
+
+// within reports whether path is dir or inside it
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// unzipFile extracts f to path, whose parent is already resolved within dst
+func unzipFile(f *zip.File, path, dst string) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return os.MkdirAll(path, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// The toolchain relies on symlinks, e.g. clang -> clang-17, which zip
+	// stores as files containing the link target
+	if mode&os.ModeSymlink != 0 {
+		link, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		// Nor may a link lead outside the archive
+		target := string(link)
+		if filepath.IsAbs(target) || !within(filepath.Join(filepath.Dir(path), target), dst) {
+			return fmt.Errorf("symlink to %s escapes archive", target)
+		}
+		return os.Symlink(target, path)
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// collectNDKCache removes the extracted NDKs in dir that haven't been used for maxAge
+func collectNDKCache(dir string, maxAge time.Duration) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// Skip extractions in progress
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ndk := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(filepath.Join(ndk, ndkUsedMarker))
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		verbosef("Removing NDK unused since %s from cache: %s", info.ModTime().Format("2006-01-02"), ndk)
+		if err = os.RemoveAll(ndk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package ndkenv
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// Exec runs the command name with args in the environment for cfg, on top of
+// this process's own, with stdin, stdout and stderr passed through. Like
+// exec.CommandContext, the command is killed if ctx is done before it exits.
+//
+// If the command runs but fails, the error is an *exec.ExitError, whose
+// ExitCode the caller can exit with in turn.
+func Exec(ctx context.Context, cfg Config, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), cfg.Env()...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Report the cancellation rather than the signal it killed the command with
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
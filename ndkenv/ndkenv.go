@@ -0,0 +1,225 @@
+// Package ndkenv builds the environment for cross-compiling cgo code for
+// Android with the NDK, as set by the ndkenv command, for build tools that
+// would rather not shell out to it.
+package ndkenv
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ABI is an Android ABI, along with how the NDK's clang and Go refer to it
+type ABI struct {
+	Name   string // Name used by Android, e.g. for jniLibs folders and abiFilters
+	Target string // clang target, without the API level
+	Triple string
+	// Directory of arch-specific headers and libraries in the sysroot, which
+	// for 32-bit ARM doesn't match the triple
+	Headers string
+	GOARCH  string
+	GOARM   string
+	GOARM64 string // Only set for arm64 baselines above the default, e.g. v8.2,lse
+	GOAMD64 string // Only set for levels above the default, e.g. v3
+	GO386   string // Only set to override the default, sse2
+}
+
+// ABINames are the ABIs LookupABI knows about, by the names it takes for them,
+// apart from armeabi, which only NDK r16b and earlier support
+var ABINames = []string{"armeabi-v7a", "arm64-v8a", "x86", "x86-64"}
+
+// ABIAliases are other names ABIs go by, such as their GOARCH or Android
+// name, with the names LookupABI takes for them
+var ABIAliases = map[string]string{
+	"x86_64":  "x86-64",
+	"amd64":   "x86-64",
+	"arm64":   "arm64-v8a",
+	"aarch64": "arm64-v8a",
+	"armv7":   "armeabi-v7a",
+	"armv7a":  "armeabi-v7a",
+	"i686":    "x86",
+	"386":     "x86",
+}
+
+// CanonicalABIName returns the name LookupABI takes for the ABI called name,
+// which may be in any case or one of ABIAliases, e.g. arm64-v8a for AArch64
+func CanonicalABIName(name string) (string, error) {
+	lower := strings.ToLower(name)
+	if canonical, ok := ABIAliases[lower]; ok {
+		return canonical, nil
+	}
+	if lower == "armeabi" {
+		return lower, nil
+	}
+	for _, n := range ABINames {
+		if lower == n {
+			return n, nil
+		}
+	}
+	return "", fmt.Errorf("unknown abi: %s, expected one of %s", name, strings.Join(ABINames, ", "))
+}
+
+// LookupABI returns the ABI with the given name, e.g. arm64-v8a, or any name
+// CanonicalABIName accepts for it
+// http://android-doc.github.io/ndk/guides/standalone_toolchain.html
+func LookupABI(name string) (ABI, error) {
+	canonical, err := CanonicalABIName(name)
+	if err != nil {
+		return ABI{}, err
+	}
+	switch canonical {
+	case "armeabi":
+		return ABI{
+			Name:    "armeabi",
+			Target:  "armv5te-none-linux-androideabi",
+			Triple:  "arm-linux-androideabi",
+			Headers: "arm-linux-androideabi",
+			GOARCH:  "arm",
+			GOARM:   "5",
+		}, nil
+	case "armeabi-v7a":
+		return ABI{
+			Name:    "armeabi-v7a",
+			Target:  "armv7-none-linux-androideabi",
+			Triple:  "armv7a-linux-androideabi",
+			Headers: "arm-linux-androideabi",
+			GOARCH:  "arm",
+			GOARM:   "7",
+		}, nil
+	case "arm64-v8a":
+		return ABI{
+			Name:    "arm64-v8a",
+			Target:  "aarch64-none-linux-android",
+			Triple:  "aarch64-linux-android",
+			Headers: "aarch64-linux-android",
+			GOARCH:  "arm64",
+		}, nil
+	case "x86":
+		return ABI{
+			Name:    "x86",
+			Target:  "i686-none-linux-android",
+			Triple:  "i686-linux-android",
+			Headers: "i686-linux-android",
+			GOARCH:  "386",
+		}, nil
+	case "x86-64":
+		return ABI{
+			Name:    "x86_64",
+			Target:  "x86_64-none-linux-android",
+			Triple:  "x86_64-linux-android",
+			Headers: "x86_64-linux-android",
+			GOARCH:  "amd64",
+		}, nil
+	default:
+		return ABI{}, fmt.Errorf("unknown abi: %s", name)
+	}
+}
+
+// Config is an ABI and API level to build for with an NDK
+type Config struct {
+	ABI
+	MinSDK int
+	NDK    string // Path of the NDK
+	// Toolchain to use from toolchains/llvm/prebuilt, e.g. linux-x86_64.
+	// Defaults to the one for this host.
+	HostTag string
+
+	// Flags added after the defaults
+	CPPFlags []string
+	CFlags   []string
+	LDFlags  []string // CGO_LDFLAGS is only set if there are any
+}
+
+// Env returns the variables to set, as KEY=VALUE, to build for abi (e.g.
+// arm64-v8a) at the given min SDK version with the NDK at ndk
+func Env(abi string, minSDK int, ndk string) ([]string, error) {
+	a, err := LookupABI(abi)
+	if err != nil {
+		return nil, err
+	}
+	return Config{ABI: a, MinSDK: minSDK, NDK: ndk}.Env(), nil
+}
+
+// Toolchain returns the path of the NDK's LLVM toolchain for t's host tag
+func (t Config) Toolchain() string {
+	hostTag := t.HostTag
+	if hostTag == "" {
+		// NDK currently only supports x86_64
+		// https://developer.android.com/ndk/guides/other_build_systems
+		hostTag = runtime.GOOS + "-x86_64"
+	}
+	return filepath.Join(t.NDK, "toolchains", "llvm", "prebuilt", hostTag)
+}
+
+func (t Config) Sysroot() string {
+	return filepath.Join(t.Toolchain(), "sysroot")
+}
+
+func (t Config) Clang() string {
+	return t.Tool("clang")
+}
+
+// Tool returns the path of one of the toolchain's binaries, e.g. llvm-ar.
+// Windows toolchains have the .exe suffix added.
+func (t Config) Tool(name string) string {
+	if strings.HasPrefix(filepath.Base(t.Toolchain()), "windows") {
+		name += ".exe"
+	}
+	return filepath.Join(t.Toolchain(), "bin", name)
+}
+
+// ISystem returns the directory of the sysroot's arch-specific headers
+func (t Config) ISystem() string {
+	return filepath.Join(t.Sysroot(), "usr", "include", t.Headers)
+}
+
+// Quote quotes arg if it contains spaces (e.g. under C:\Program Files), the
+// way the go command splits CC and CGO_*FLAGS. Backslashes are left alone,
+// so Windows paths needn't be escaped.
+func Quote(arg string) string {
+	switch {
+	case !strings.ContainsAny(arg, " \t\n\r'\""):
+		return arg
+	case !strings.Contains(arg, `"`):
+		return `"` + arg + `"`
+	default:
+		return "'" + arg + "'"
+	}
+}
+
+// Env returns the variables to set, as KEY=VALUE, to build for t
+func (t Config) Env() []string {
+	GOARCH := fmt.Sprintf("GOARCH=%s", t.GOARCH)
+	GOARM := fmt.Sprintf("GOARM=%s", t.GOARM)
+	CC := fmt.Sprintf("CC=%s -target %s%d %s",
+		Quote(t.Clang()), t.Target, t.MinSDK, Quote("--sysroot="+t.Sysroot()))
+	// For build systems that assemble .s files with $(AS) -o, rather than through CC
+	AS := fmt.Sprintf("AS=%s -target %s%d %s -c",
+		Quote(t.Clang()), t.Target, t.MinSDK, Quote("--sysroot="+t.Sysroot()))
+	// Preprocessor flags also apply to C++ and .S files, unlike CGO_CFLAGS
+	CGO_CPPFLAGS := fmt.Sprintf("CGO_CPPFLAGS=-isystem %s %s",
+		Quote(t.ISystem()+"/"), strings.Join(t.CPPFlags, " "))
+	CGO_CFLAGS := "CGO_CFLAGS=" + strings.Join(t.CFlags, " ")
+
+	env := []string{"CGO_ENABLED=1", "GOOS=android", GOARCH, GOARM, CC, AS, CGO_CPPFLAGS, CGO_CFLAGS}
+	// So that autotools and Makefiles don't pick up the host's binutils
+	for _, tool := range []struct{ name, bin string }{
+		{"AR", "llvm-ar"}, {"RANLIB", "llvm-ranlib"}, {"NM", "llvm-nm"}, {"STRIP", "llvm-strip"}, {"LD", "ld.lld"},
+	} {
+		env = append(env, tool.name+"="+t.Tool(tool.bin))
+	}
+	if t.GOARM64 != "" {
+		env = append(env, "GOARM64="+t.GOARM64)
+	}
+	if t.GOAMD64 != "" {
+		env = append(env, "GOAMD64="+t.GOAMD64)
+	}
+	if t.GO386 != "" {
+		env = append(env, "GO386="+t.GO386)
+	}
+	if len(t.LDFlags) > 0 {
+		env = append(env, "CGO_LDFLAGS="+strings.Join(t.LDFlags, " "))
+	}
+	return env
+}
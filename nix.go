@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type nixCommand struct{}
+
+// Escapes a string for use inside a double-quoted Nix string
+var nixEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `${`, `\${`)
+
+func (c *nixCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	version, err := ndkVersion(t.ndk)
+	if err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+
+	fmt.Printf(`# Generated by ndkenv
+{ pkgs ? import <nixpkgs> {
+    config.allowUnfree = true;
+    config.android_sdk.accept_license = true;
+  }
+}:
+
+let
+  android = pkgs.androidenv.composeAndroidPackages {
+    includeNDK = true;
+    ndkVersions = [ "%s" ];
+  };
+  ndk = "${android.androidsdk}/libexec/android-sdk/ndk/%s";
+  hostTag = if pkgs.stdenv.isDarwin then "darwin-x86_64" else "linux-x86_64";
+  toolchain = "${ndk}/toolchains/llvm/prebuilt/${hostTag}";
+in
+pkgs.mkShell {
+  packages = [ pkgs.go ];
+
+`, version, version)
+	for _, kv := range t.env(noEnv) {
+		key, value, _ := strings.Cut(kv, "=")
+		// Swap local paths for their equivalents in the nix store
+		value = nixEscaper.Replace(value)
+		value = strings.ReplaceAll(value, nixEscaper.Replace(t.toolchain), "${toolchain}")
+		value = strings.ReplaceAll(value, nixEscaper.Replace(t.ndk), "${ndk}")
+		fmt.Printf("  %s = \"%s\";\n", key, value)
+	}
+	_, err = fmt.Fprintln(os.Stdout, "}")
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// timestamper prefixes each line written to it with the time elapsed since start
+type timestamper struct {
+	w       io.Writer
+	start   time.Time
+	midLine bool // Whether the last write ended partway through a line
+}
+
+func (t *timestamper) Write(p []byte) (int, error) {
+	var buf []byte
+	for _, c := range p {
+		if !t.midLine {
+			buf = append(buf, fmt.Sprintf("[%9.3fs] ", time.Since(t.start).Seconds())...)
+			t.midLine = true
+		}
+		buf = append(buf, c)
+		if c == '\n' {
+			t.midLine = false
+		}
+	}
+	if _, err := t.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syncWriter serializes writes to w, which is shared by the command's stdout and
+// stderr, so that each write arrives in one piece
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/iamcalledrob/ndkenv/ndkenv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ndkPlatforms is the range of API levels an NDK supports, from meta/platforms.json
+type ndkPlatforms struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+func readNDKPlatforms(ndk string) (ndkPlatforms, error) {
+	var p ndkPlatforms
+	data, err := os.ReadFile(filepath.Join(ndk, "meta", "platforms.json"))
+	if err != nil {
+		return p, err
+	}
+	if err = json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("reading %s: %w", filepath.Join(ndk, "meta", "platforms.json"), err)
+	}
+	return p, nil
+}
+
+// ndkABI is an ABI's entry in meta/abis.json
+type ndkABI struct {
+	Bitness    int    `json:"bitness"`
+	Default    bool   `json:"default"`
+	Deprecated bool   `json:"deprecated"`
+	Arch       string `json:"arch"`
+	Triple     string `json:"triple"`
+	LLVMTriple string `json:"llvm_triple"`
+}
+
+// readNDKABIs returns the ABIs in the NDK's meta/abis.json, by Android name
+func readNDKABIs(ndk string) (map[string]ndkABI, error) {
+	abis := make(map[string]ndkABI)
+	if err := readJSON(filepath.Join(ndk, "meta", "abis.json"), &abis); err != nil {
+		return nil, err
+	}
+	return abis, nil
+}
+
+// apiLevel is an API level given to --min-sdk-version, or autoSDK
+type apiLevel int
+
+const (
+	// autoSDK, given as -s auto, selects the lowest API level the NDK
+	// supports for the ABI
+	autoSDK apiLevel = -1
+	// projectSDK, given as -s project, selects the min SDK version of the
+	// surrounding Android project
+	projectSDK apiLevel = -2
+)
+
+func (v *apiLevel) UnmarshalFlag(value string) error {
+	switch value {
+	case "auto":
+		*v = autoSDK
+		return nil
+	case "project":
+		*v = projectSDK
+		return nil
+	}
+	api, err := strconv.Atoi(value)
+	if err != nil || api < 1 {
+		return fmt.Errorf("invalid min SDK version %s, expected an API level such as 21, auto or project", value)
+	}
+	*v = apiLevel(api)
+	return nil
+}
+
+// ndkABIArchs maps arch in meta/abis.json to GOARCH, where they differ
+var ndkABIArchs = map[string]string{"x86": "386", "x86_64": "amd64"}
+
+// metaABI returns the ABI called name (by Android) in the NDK's meta/abis.json,
+// for ABIs added in NDKs newer than ndkenv knows about, e.g. riscv64
+func metaABI(ndk, name string) (ndkenv.ABI, error) {
+	abis, err := readNDKABIs(ndk)
+	if err != nil {
+		return ndkenv.ABI{}, err
+	}
+	m, ok := abis[name]
+	if !ok || m.Triple == "" {
+		return ndkenv.ABI{}, fmt.Errorf("no abi %s in %s", name, filepath.Join(ndk, "meta", "abis.json"))
+	}
+	abi := ndkenv.ABI{
+		Name:    name,
+		Target:  m.LLVMTriple,
+		Triple:  m.Triple,
+		Headers: m.Triple,
+		GOARCH:  m.Arch,
+	}
+	if abi.Target == "" {
+		abi.Target = strings.Replace(m.Triple, "-linux", "-none-linux", 1)
+	}
+	if goarch, ok := ndkABIArchs[m.Arch]; ok {
+		abi.GOARCH = goarch
+	}
+	return abi, nil
+}
+
+// 64-bit ABIs were introduced in Android 5.0
+const min64BitSDK = 21
+
+// minSDKFloor returns the lowest API level the NDK can build for abi, or 0 if
+// it's unknown because the NDK predates meta/platforms.json
+func minSDKFloor(ndk string, abi ndkenv.ABI) (int, error) {
+	p, err := readNDKPlatforms(ndk)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	floor := p.Min
+	if (abi.GOARCH == "arm64" || abi.GOARCH == "amd64") && floor < min64BitSDK {
+		floor = min64BitSDK
+	}
+	return floor, nil
+}
+
+// checkMinSDK fails with a clear message if api is outside the range of API
+// levels the NDK supports for abi, which clang would otherwise fail with
+// obscure errors about. With --clamp-sdk, the nearest level in range is
+// returned instead.
+func checkMinSDK(ndk string, abi ndkenv.ABI, api int) (int, error) {
+	floor, err := minSDKFloor(ndk, abi)
+	if err != nil {
+		return api, err
+	}
+	version, _ := ndkVersion(ndk)
+	// Newer API levels than the NDK's have no sysroot libraries to link against
+	if p, err := readNDKPlatforms(ndk); err == nil && p.Max != 0 && api > p.Max {
+		if !opts.ClampSDK {
+			return 0, fmt.Errorf("min SDK version %d is above %d, the highest NDK %s supports (pass --clamp-sdk to use %d, or use a newer NDK)",
+				api, p.Max, version, p.Max)
+		}
+		warnf("lowering min SDK version from %d to %d, the highest NDK %s supports",
+			api, p.Max, version)
+		return p.Max, nil
+	}
+	if api >= floor {
+		return api, nil
+	}
+	if !opts.ClampSDK {
+		return 0, fmt.Errorf("min SDK version %d is below %d, the lowest NDK %s supports for %s (pass --clamp-sdk to use %d)",
+			api, floor, version, abi.Name, floor)
+	}
+	warnf("raising min SDK version from %d to %d, the lowest NDK %s supports for %s",
+		api, floor, version, abi.Name)
+	return floor, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// postBuild is a pipeline of steps run on the library built for each ABI
+type postBuild struct {
+	// Path of the built library, which may contain {abi} and {api}
+	Artifact string   `toml:"artifact"`
+	Steps    []string `toml:"steps"`
+}
+
+var postBuildSteps = []string{"strip", "align-check", "checksum", "jnilibs", "needed-check"}
+
+// Android 15 devices can use 16 KB pages, which 64-bit libraries must be aligned to
+const (
+	pageAlign64 = 16 * 1024
+	pageAlign32 = 4 * 1024
+)
+
+func (p *postBuild) needsProject() bool {
+	return p != nil && contains(p.Steps, "jnilibs")
+}
+
+// run runs each step on the artifact built for t
+func (p *postBuild) run(t target, project androidProject) error {
+	artifact := t.expand(p.Artifact)
+	for _, step := range p.Steps {
+		var err error
+		switch step {
+		case "strip":
+			cmd := exec.Command(t.ndkConfig().Tool("llvm-strip"), "--strip-unneeded", artifact)
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			err = cmd.Run()
+		case "align-check":
+			err = checkAlignment(artifact, t)
+		case "checksum":
+			err = writeChecksum(artifact)
+		case "jnilibs":
+			err = installJNILib(project, t.ABI, artifact)
+		case "needed-check":
+			// Libraries are loaded from wherever they're packaged
+			dir := filepath.Dir(artifact)
+			if contains(p.Steps, "jnilibs") {
+				dir = filepath.Join(project.jniLibs, t.Name)
+			}
+			err = checkNeeded(artifact, dir, t)
+		}
+		if err != nil {
+			return fmt.Errorf("post-build %s of %s: %w", step, artifact, err)
+		}
+		verbosef("Post-build %s of %s done", step, artifact)
+	}
+	return nil
+}
+
+// checkAlignment checks that the library's segments are aligned so that it
+// loads on devices with the largest page size used for t's ABI
+func checkAlignment(path string, t target) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	align := uint64(pageAlign32)
+	if f.Class == elf.ELFCLASS64 {
+		align = pageAlign64
+	}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD && prog.Align < align {
+			return fmt.Errorf("LOAD segment aligned to %d bytes, %s needs %d (link with -Wl,-z,max-page-size=%d)",
+				prog.Align, t.Name, align, align)
+		}
+	}
+	return nil
+}
+
+// checkNeeded checks that every library artifact depends on (DT_NEEDED), and
+// every library they depend on in turn, is either provided by the system for
+// t's min SDK version or packaged alongside it in dir
+func checkNeeded(artifact, dir string, t target) error {
+	system := t.libDir()
+	var missing []string
+	seen := make(map[string]bool)
+	queue := []string{artifact}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		f, err := elf.Open(path)
+		if err != nil {
+			return err
+		}
+		needed, err := f.ImportedLibraries()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading dependencies of %s: %w", path, err)
+		}
+		for _, name := range needed {
+			if seen[name] || isFile(filepath.Join(system, name)) {
+				continue
+			}
+			seen[name] = true
+			if lib := filepath.Join(dir, name); isFile(lib) {
+				queue = append(queue, lib)
+			} else {
+				missing = append(missing, fmt.Sprintf("%s (needed by %s)", name, filepath.Base(path)))
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("%d libraries missing from %s for %s:\n  %s", len(missing), dir, t.Name, strings.Join(missing, "\n  "))
+	if seen["libc++_shared.so"] && !isFile(filepath.Join(dir, "libc++_shared.so")) {
+		msg += fmt.Sprintf("\nlibc++_shared.so is in the NDK at %s", filepath.Join(t.sysroot, "usr", "lib", t.Headers))
+	}
+	return errors.New(msg)
+}
+
+// writeChecksum writes the sha256 of path to path.sha256, in sha256sum's format
+func writeChecksum(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(path))
+	return os.WriteFile(path+".sha256", []byte(line), 0644)
+}
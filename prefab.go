@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prefabModule is a module's module.json in a Prefab package
+// https://google.github.io/prefab/
+type prefabModule struct {
+	ExportLibraries []string `json:"export_libraries"`
+	LibraryName     string   `json:"library_name"`
+}
+
+// prefabABI is the abi.json of a module's library for one ABI
+type prefabABI struct {
+	ABI string `json:"abi"`
+	API int    `json:"api"`
+	STL string `json:"stl"`
+}
+
+// prefabFlags returns the flags for building for abi at the given API level
+// against each module of the Prefab package in aar
+func prefabFlags(aar, abi string, api int) (flagSet, error) {
+	dir, err := extractPrefab(aar)
+	if err != nil {
+		return flagSet{}, err
+	}
+	modules, err := os.ReadDir(filepath.Join(dir, "modules"))
+	if err != nil {
+		return flagSet{}, err
+	}
+	var flags flagSet
+	for _, entry := range modules {
+		name := entry.Name()
+		module := filepath.Join(dir, "modules", name)
+		var m prefabModule
+		if err = readJSON(filepath.Join(module, "module.json"), &m); err != nil && !os.IsNotExist(err) {
+			return flagSet{}, err
+		}
+
+		// Libraries may have headers per ABI, in place of the module's
+		include := filepath.Join(module, "include")
+		libs := filepath.Join(module, "libs", "android."+abi)
+		if isDir(filepath.Join(libs, "include")) {
+			include = filepath.Join(libs, "include")
+		}
+		if isDir(include) {
+			flags.ISystem = append(flags.ISystem, include)
+		}
+		for _, lib := range m.ExportLibraries {
+			// References to other modules are only resolved by Prefab itself
+			if strings.HasPrefix(lib, "-") {
+				flags.LDFlags = append(flags.LDFlags, lib)
+			}
+		}
+		if !isDir(filepath.Join(module, "libs")) {
+			continue // Header-only
+		}
+		if !isDir(libs) {
+			return flagSet{}, fmt.Errorf("module %s has no library for %s", name, abi)
+		}
+		var info prefabABI
+		if err = readJSON(filepath.Join(libs, "abi.json"), &info); err != nil {
+			return flagSet{}, err
+		}
+		if info.API > api {
+			return flagSet{}, fmt.Errorf("module %s needs a min SDK version of at least %d for %s, got %d", name, info.API, abi, api)
+		}
+		libName := m.LibraryName
+		if libName == "" {
+			libName = "lib" + name
+		}
+		if !isFile(filepath.Join(libs, libName+".so")) && !isFile(filepath.Join(libs, libName+".a")) {
+			return flagSet{}, fmt.Errorf("module %s has no %s.so or %s.a for %s", name, libName, libName, abi)
+		}
+		flags.LDFlags = append(flags.LDFlags, "-L"+libs, "-l"+strings.TrimPrefix(libName, "lib"))
+		// cgo links with clang rather than clang++, so C++ libraries need the STL too
+		switch info.STL {
+		case "c++_shared":
+			flags.LDFlags = appendNew(flags.LDFlags, "-lc++_shared")
+		case "c++_static":
+			flags.LDFlags = appendNew(flags.LDFlags, "-lc++_static", "-lc++abi")
+		}
+	}
+	return flags, nil
+}
+
+// extractPrefab extracts the Prefab package in aar into the cache, if it isn't
+// there already, returning the path of its prefab directory
+func extractPrefab(aar string) (string, error) {
+	cache, err := ndkCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash, err := archiveHash(cache, aar)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(cache, "prefab", hash)
+	if isDir(dst) {
+		return dst, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), ".extract-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err = unzip(aar, tmp); err != nil {
+		return "", err
+	}
+	if !isFile(filepath.Join(tmp, "prefab", "prefab.json")) {
+		return "", fmt.Errorf("no prefab/prefab.json, is it an AAR with a Prefab package?")
+	}
+	if err = os.Rename(filepath.Join(tmp, "prefab"), dst); err != nil && !isDir(dst) {
+		return "", err
+	}
+	return dst, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// appendNew appends each of values to s that isn't already in it
+func appendNew(s []string, values ...string) []string {
+	for _, v := range values {
+		if !contains(s, v) {
+			s = append(s, v)
+		}
+	}
+	return s
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type printVarCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"NAME" description:"Name of the variable to print, e.g. CC"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *printVarCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, kv := range t.env(os.Getenv) {
+		name, value, _ := strings.Cut(kv, "=")
+		if name == c.Args.Name {
+			fmt.Println(value)
+			return nil
+		}
+		names = append(names, name)
+	}
+	return fmt.Errorf("%s isn't set by ndkenv, expected one of: %s", c.Args.Name, strings.Join(names, ", "))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+type requirementsCommand struct {
+	APK       bool `long:"apk" description:"Also list the SDK platform and build-tools needed by ndkenv apk"`
+	TargetSDK int  `long:"target-sdk-version" description:"Target android SDK version the APK is built with (default: the newest installed platform)"`
+}
+
+func (c *requirementsCommand) Execute([]string) error {
+	var packages []string
+	err := forEachABI(func(string) error {
+		t, err := resolve()
+		if err != nil {
+			return err
+		}
+		version, err := ndkVersion(t.ndk)
+		if err != nil {
+			return fmt.Errorf("reading NDK version: %w", err)
+		}
+		if p := "ndk;" + version; !contains(packages, p) {
+			packages = append(packages, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.APK {
+		sdk := androidSDKFolder()
+		if c.TargetSDK == 0 {
+			if c.TargetSDK, err = newestPlatform(sdk); err != nil {
+				return fmt.Errorf("locating SDK platform: %w, pass --target-sdk-version", err)
+			}
+		}
+		buildTools, err := newestSubdir(filepath.Join(sdk, "build-tools"))
+		if err != nil {
+			return fmt.Errorf("locating SDK build-tools: %w", err)
+		}
+		packages = append(packages, fmt.Sprintf("platforms;android-%d", c.TargetSDK), "build-tools;"+filepath.Base(buildTools))
+	}
+	for _, p := range packages {
+		fmt.Println(p)
+	}
+	return nil
+}
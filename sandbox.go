@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// sandboxEnv returns variables that keep everything the go command downloads
+// or caches inside dir, isolated from the user's own Go directories
+func sandboxEnv(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	gopath := filepath.Join(dir, "gopath")
+	return []string{
+		"GOPATH=" + gopath,
+		"GOMODCACHE=" + filepath.Join(gopath, "pkg", "mod"),
+		"GOCACHE=" + filepath.Join(dir, "cache"),
+	}, nil
+}
+
+// Variables kept by --isolate, so the go command can still find itself, its
+// caches and the modules it downloads, and terminals still work
+var isolatedEnv = []string{"PATH", "HOME", "USER", "TERM", "TMPDIR", "GOROOT", "GOPATH", "GOMODCACHE", "GOCACHE",
+	"GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB"}
+
+// Variables Windows programs, Go included, need to run at all
+var isolatedWindowsEnv = []string{"SystemRoot", "ComSpec", "PATHEXT", "TEMP", "TMP",
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA"}
+
+// inheritedEnv returns the part of ndkenv's environment that commands are run
+// with underneath the target's variables: all of it, or with --isolate just the
+// variables in isolatedEnv and those named in --respect-env, so that stray
+// CC, CFLAGS or GOFLAGS set for the host don't leak into the build
+func inheritedEnv() []string {
+	if !opts.Isolate {
+		return os.Environ()
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); isInherited(name) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// commandEnv returns the environment to run commands with: env, the target's
+// variables, on top of inheritedEnv. Inherited variables that env also sets
+// are left out, rather than relying on later duplicates winning.
+func commandEnv(env []string) []string {
+	var names []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	var merged []string
+	for _, kv := range inheritedEnv() {
+		if name, _, _ := strings.Cut(kv, "="); !contains(names, name) {
+			merged = append(merged, kv)
+		}
+	}
+	return append(merged, env...)
+}
+
+// inheritedGetenv is os.Getenv, limited to inheritedEnv
+func inheritedGetenv(name string) string {
+	if !isInherited(name) {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+func isInherited(name string) bool {
+	if !opts.Isolate {
+		return true
+	}
+	kept := append(isolatedEnv, strings.Split(opts.RespectEnv, ",")...)
+	if runtime.GOOS == "windows" {
+		kept = append(kept, isolatedWindowsEnv...)
+	}
+	for _, k := range kept {
+		// Variable names aren't case sensitive on Windows, where it's Path
+		if k == name || runtime.GOOS == "windows" && strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// populateSandbox downloads the module's dependencies into a new sandbox, so
+// that a failure to download is reported separately from a failure to build
+func populateSandbox(dir string, env []string) error {
+	modCache := filepath.Join(dir, "gopath", "pkg", "mod")
+	if isDir(modCache) {
+		return nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if !hasGoMod(wd) {
+		return nil
+	}
+	infof("Downloading modules into sandbox %s", dir)
+	cmd := exec.Command("go", "mod", "download")
+	cmd.Env = env
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("go mod download: %w", err)
+	}
+	// Modules without dependencies don't create it, but shouldn't be downloaded again
+	return os.MkdirAll(modCache, 0755)
+}
+
+// hasGoMod reports whether dir is inside a Go module
+func hasGoMod(dir string) bool {
+	for {
+		if isFile(filepath.Join(dir, "go.mod")) {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// findSDKManager returns the path of sdkmanager, on PATH or in the SDK's
+// cmdline-tools, or "" if it isn't installed
+func findSDKManager() string {
+	name := "sdkmanager"
+	if runtime.GOOS == "windows" {
+		name += ".bat"
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	sdk := androidSDKFolder()
+	candidates := []string{filepath.Join(sdk, "cmdline-tools", "latest", "bin", name)}
+	versions, _ := filepath.Glob(filepath.Join(sdk, "cmdline-tools", "*", "bin", name))
+	candidates = append(candidates, versions...)
+	// Before cmdline-tools, sdkmanager came with the SDK tools
+	candidates = append(candidates, filepath.Join(sdk, "tools", "bin", name))
+	for _, path := range candidates {
+		if isFile(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// sdkmanagerInstallNDK installs the newest NDK matching version (or any NDK,
+// if version is "") into the SDK with sdkmanager, returning its path
+func sdkmanagerInstallNDK(sdkmanager, version string) (string, error) {
+	sdk := androidSDKFolder()
+	channel := "--channel=" + strconv.Itoa(sdkChannels[opts.Channel])
+	out, err := exec.Command(sdkmanager, "--sdk_root="+sdk, channel, "--list").Output()
+	if err != nil {
+		return "", fmt.Errorf("listing packages with sdkmanager: %w", err)
+	}
+	// Packages are listed as e.g. ndk;26.1.10909125 | 26.1.10909125 | NDK (Side by side) 26.1.10909125
+	var newest string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "ndk;") {
+			continue
+		}
+		v := strings.TrimPrefix(fields[0], "ndk;")
+		if (version == "" || matchVersion(version, v)) && inChannel(v, version) &&
+			(newest == "" || compareVersions(v, newest) > 0) {
+			newest = v
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("sdkmanager has no %s NDK matching version %s", opts.Channel, version)
+	}
+
+	infof("Installing ndk;%s with sdkmanager", newest)
+	cmd := exec.Command(sdkmanager, "--sdk_root="+sdk, channel, "ndk;"+newest)
+	// Output goes to stderr, so it doesn't mix with what ndkenv prints
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if opts.AcceptLicenses {
+		// sdkmanager asks to accept each license in turn
+		cmd.Stdin = strings.NewReader(strings.Repeat("y\n", 100))
+	}
+	if err = cmd.Run(); err != nil {
+		return "", fmt.Errorf("running sdkmanager: %w", err)
+	}
+	ndk := filepath.Join(sdk, "ndk", newest)
+	if _, err = ndkVersion(ndk); err != nil {
+		return "", fmt.Errorf("sdkmanager didn't install NDK %s in %s", newest, ndk)
+	}
+	return ndk, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type serveCommand struct {
+	Listen string `long:"listen" default:"127.0.0.1:0" value-name:"ADDR" description:"Address to listen on, by default a free port on localhost"`
+}
+
+// envResponse is returned by GET /env
+type envResponse struct {
+	ABI           string            `json:"abi"`
+	MinSDKVersion int               `json:"min_sdk_version"`
+	NDK           string            `json:"ndk"`
+	NDKVersion    string            `json:"ndk_version"`
+	Triple        string            `json:"triple"`
+	Clang         string            `json:"clang"`
+	Sysroot       string            `json:"sysroot"`
+	Env           map[string]string `json:"env"`
+}
+
+// newEnvResponse describes t, with env as the variables set for it
+func newEnvResponse(t target, env []string) (envResponse, error) {
+	resp := envResponse{
+		ABI:           t.Name,
+		MinSDKVersion: t.api,
+		NDK:           t.ndk,
+		Triple:        t.Triple,
+		Clang:         t.clang,
+		Sysroot:       t.sysroot,
+		Env:           make(map[string]string),
+	}
+	var err error
+	if resp.NDKVersion, err = ndkVersion(t.ndk); err != nil {
+		return envResponse{}, fmt.Errorf("reading NDK version: %w", err)
+	}
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		resp.Env[name] = value
+	}
+	return resp, nil
+}
+
+// envServer answers requests for the environment of a target, resolving each
+// distinct request once for as long as the project config is unchanged
+type envServer struct {
+	reset func() // Resets opts to those given on the command line
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+func (c *serveCommand) Execute([]string) error {
+	ln, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return err
+	}
+	// Tools starting the server read the port from here
+	infof("Listening on http://%s", ln.Addr())
+	base := opts
+	mux := http.NewServeMux()
+	mux.Handle("/env", &envServer{reset: func() { opts = base }, cache: make(map[string][]byte)})
+	return http.Serve(ln, mux)
+}
+
+// ServeHTTP resolves the target given by the abi, api, profile and ndk-version
+// query parameters, which default to the options ndkenv serve was run with
+func (s *envServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	wd, _ := os.Getwd()
+	key := query.Encode()
+	if path := findConfig(wd); path != "" {
+		if info, err := os.Stat(path); err == nil {
+			key += " " + info.ModTime().Format(time.RFC3339Nano)
+		}
+	}
+
+	// resolve works on opts, so requests are handled one at a time
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.cache[key]
+	if !ok {
+		resp, err := s.resolve(query.Get("abi"), query.Get("api"), query.Get("profile"), query.Get("ndk-version"))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if data, err = json.MarshalIndent(resp, "", "  "); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.cache[key] = data
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+func (s *envServer) resolve(abi, api, profile, version string) (envResponse, error) {
+	s.reset()
+	if abi != "" {
+		opts.ABI, opts.ABIs = "", []string{abi}
+	}
+	if api != "" {
+		if err := opts.MinSDKVersion.UnmarshalFlag(api); err != nil {
+			return envResponse{}, err
+		}
+	}
+	if profile != "" {
+		opts.Profile = profile
+	}
+	if version != "" {
+		opts.NDKVersion = version
+	}
+	t, err := resolve()
+	if err != nil {
+		return envResponse{}, err
+	}
+	if err = t.check(); err != nil {
+		return envResponse{}, err
+	}
+	// The environment of whoever is asking isn't known, so nothing is inherited
+	return newEnvResponse(t, t.env(noEnv))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type shellCommand struct{}
+
+// Execute starts $SHELL with the environment for the target, exiting with its
+// exit code once it's closed
+func (c *shellCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	if err = t.check(); err != nil {
+		return err
+	}
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	hint := fmt.Sprintf("(ndk:%s) ", t.Name)
+	// NDKENV_SHELL is for prompts that the hint doesn't make it into, e.g. fish's
+	env := append(t.env(inheritedGetenv), "NDKENV_SHELL="+t.Name)
+	if opts.PrependPath {
+		env = append(env, t.pathEnv())
+	}
+	if err = checkConflicts(env); err != nil {
+		return err
+	}
+
+	var args []string
+	var rcPath string
+	if strings.TrimSuffix(filepath.Base(shell), ".exe") == "bash" {
+		// bash sets PS1 in .bashrc, so the hint is added after that's run
+		rc, err := os.CreateTemp("", "ndkenv-bashrc-")
+		if err != nil {
+			return err
+		}
+		rcPath = rc.Name()
+		defer os.Remove(rcPath)
+		_, err = fmt.Fprintf(rc, "[ -f ~/.bashrc ] && . ~/.bashrc\nPS1='%s'\"$PS1\"\n", posixQuoter.Replace(hint))
+		if closeErr := rc.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		args = []string{"--rcfile", rcPath}
+	} else {
+		ps1 := inheritedGetenv("PS1")
+		if ps1 == "" {
+			ps1 = "$ "
+		}
+		env = append(env, "PS1="+hint+ps1)
+	}
+
+	cmd := exec.Command(shell, args...)
+	cmd.Env = commandEnv(env)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	infof("Starting %s for %s with min SDK version %d, exit to leave it", shell, t.Name, t.api)
+	err = runForwardingSignals(cmd)
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		// Deferred calls are skipped by os.Exit
+		if rcPath != "" {
+			os.Remove(rcPath)
+		}
+		os.Exit(exitError.ExitCode())
+	}
+	return err
+}
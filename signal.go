@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// runForwardingSignals runs cmd, passing on the signals that would stop ndkenv,
+// such as SIGINT and SIGTERM, so the command can clean up and exit rather than
+// being left running when ndkenv dies
+func runForwardingSignals(cmd *exec.Cmd) error {
+	detach(cmd)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	for {
+		select {
+		case sig := <-signals:
+			forward(cmd, sig)
+		case err := <-done:
+			return err
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+func detach(*exec.Cmd) {}
+
+// forward does nothing, as the console sends Ctrl-C to every process attached
+// to it, so ndkenv only has to outlive the command
+func forward(*exec.Cmd, os.Signal) {}
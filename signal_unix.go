@@ -0,0 +1,41 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// detach starts cmd in its own process group, so signals can be forwarded to
+// everything it runs, such as the compilers go build starts. In the foreground
+// of a terminal it stays in ndkenv's, which Ctrl-C already interrupts as a
+// whole, so that the command can still read from the terminal.
+func detach(cmd *exec.Cmd) {
+	if !inForeground() {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+}
+
+func forward(cmd *exec.Cmd, sig os.Signal) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		_ = syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+		return
+	}
+	// The terminal sent Ctrl-C to the command too
+	if sig != syscall.SIGINT {
+		_ = cmd.Process.Signal(sig)
+	}
+}
+
+// inForeground reports whether ndkenv is in the foreground process group of
+// the terminal on stdin
+func inForeground() bool {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdin.Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	return errno == 0 && int(pgrp) == syscall.Getpgrp()
+}
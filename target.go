@@ -0,0 +1,574 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/iamcalledrob/ndkenv/ndkenv"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// target is an ABI and API level to build for, along with the NDK toolchain
+// used to do so
+type target struct {
+	ndkenv.ABI
+	api       int
+	ndk       string
+	toolchain string
+	sysroot   string
+	clang     string
+	iSystem   string
+	flags     flagSet  // Extra flags from the project config
+	link      []string // Libraries from the sysroot to link against, included in flags
+	extraEnv  []string // Variables from --env and the config, as KEY=VALUE
+	postBuild *postBuild
+	outDir    string // From out_dir in the config, with {abi} and {api} still to expand
+	hostErr   error  // Why this host can't run any NDK toolchain, if it can't
+}
+
+// Names NDKs give architectures in host tags, where they differ from GOARCH
+var hostTagArchs = map[string][]string{"amd64": {"x86_64"}, "arm64": {"aarch64", "arm64"}, "386": {"x86"}}
+
+// ndkHostTag returns the host tag of the NDK toolchain to use from ndk's
+// toolchains/llvm/prebuilt, e.g. linux-x86_64
+func ndkHostTag(ndk string) (string, error) {
+	if opts.HostTag != "" {
+		return opts.HostTag, nil
+	}
+	// Prefer a native toolchain, in NDKs that have one for this host, which
+	// includes NDKs built for hosts Google doesn't provide toolchains for
+	archs, ok := hostTagArchs[runtime.GOARCH]
+	if !ok {
+		archs = []string{runtime.GOARCH}
+	}
+	for _, arch := range archs {
+		hostTag := runtime.GOOS + "-" + arch
+		if isDir(filepath.Join(ndk, "toolchains", "llvm", "prebuilt", hostTag)) {
+			if hostTag != runtime.GOOS+"-x86_64" {
+				verbosef("Using the native %s toolchain", hostTag)
+			}
+			return hostTag, nil
+		}
+	}
+	// Otherwise only x86_64 is supported, which arm64 hosts can emulate
+	// https://developer.android.com/ndk/guides/other_build_systems
+	switch {
+	case runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows",
+		runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64":
+		return "", fmt.Errorf("the NDK has no toolchain that can run on %s/%s (%s-%s), only on linux, darwin and windows x86_64 hosts.\n"+
+			"Build in a linux/amd64 container instead (see ndkenv init-docker), or pass --host-tag to use a toolchain run under emulation, e.g. --host-tag linux-x86_64",
+			runtime.GOOS, runtime.GOARCH, runtime.GOOS, archs[0])
+	}
+	if runtime.GOARCH != "amd64" {
+		verbosef("Using the %s-x86_64 toolchain, as the NDK has none for %s (on macOS it's universal since NDK r23, otherwise it runs under Rosetta)",
+			runtime.GOOS, runtime.GOARCH)
+	}
+	return runtime.GOOS + "-x86_64", nil
+}
+
+// loadProject reads the config and lock of the project containing the working
+// dir, if there is one
+func loadProject() (config, lock, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return config{}, lock{}, nil
+	}
+	path := findConfig(wd)
+	if path == "" {
+		return config{}, lock{}, nil
+	}
+	projectCfg, err := loadConfig(path)
+	if err != nil {
+		return config{}, lock{}, err
+	}
+	projectLock, err := readLock(lockPath(path))
+	if err != nil {
+		return config{}, lock{}, err
+	}
+	return projectCfg, projectLock, nil
+}
+
+// locateNDK sets opts.NDK to the NDK to use, given by the options or the
+// project config, or else found automatically
+func locateNDK(projectCfg config, projectLock lock) error {
+	// Either of --ndk or --ndk-archive overrides both ndk and ndk_archive
+	if opts.NDK != "" || opts.NDKArchive != "" {
+		explain("using --ndk or --ndk-archive, without looking anywhere else")
+	} else if opts.NDK, opts.NDKArchive = projectCfg.NDK, projectCfg.NDKArchive; opts.NDK != "" || opts.NDKArchive != "" {
+		explain("using ndk or ndk_archive from the config, without looking anywhere else")
+	}
+	if opts.NDKVersion == "" {
+		opts.NDKVersion = projectCfg.NDKVersion
+	}
+	var err error
+	if opts.NDK == "" && opts.NDKArchive != "" {
+		if opts.NDK, err = cachedNDK(opts.NDKArchive); err != nil {
+			return fmt.Errorf("--ndk-archive: %w", err)
+		}
+	}
+	if opts.NDK == "" {
+		// Stick to the locked version until the requested version changes
+		version := opts.NDKVersion
+		if projectLock.NDKVersion != "" && projectLock.Constraint == version {
+			explain("looking for NDK %s, locked in .ndkenv.lock", projectLock.NDKVersion)
+			version = projectLock.NDKVersion
+		}
+		opts.NDK, err = findNDKCached(version, ndkSearchPaths(projectCfg))
+		if err != nil {
+			if sdkmanager := findSDKManager(); sdkmanager != "" {
+				if !opts.AutoInstall {
+					return fmt.Errorf("Automatically locating NDK: %w (pass --auto-install to install it with sdkmanager)", err)
+				}
+				opts.NDK, err = sdkmanagerInstallNDK(sdkmanager, version)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Automatically locating NDK: %w", err)
+		}
+	}
+	return nil
+}
+
+// ndkSearchPaths returns the folders passed to --ndk-search-path, then those
+// in the project config
+func ndkSearchPaths(projectCfg config) []string {
+	return append(append([]string(nil), opts.NDKSearchPath...), projectCfg.NDKSearchPaths...)
+}
+
+// resolve fills in opts with defaults from the project config, then locates
+// the NDK and works out the target to build for.
+func resolve() (target, error) {
+	projectCfg, projectLock, err := loadProject()
+	if err != nil {
+		return target{}, err
+	}
+	if specs := abiSpecs(); opts.ABI == "" && len(specs) > 0 {
+		if len(specs) > 1 {
+			return target{}, fmt.Errorf("only one --abi can be used here, got %s", strings.Join(specs, ", "))
+		}
+		if err := selectABI(specs[0]); err != nil {
+			return target{}, err
+		}
+	}
+	if opts.ABI == "" {
+		opts.ABI = projectCfg.ABI
+	}
+	if opts.MinSDKVersion == 0 {
+		opts.MinSDKVersion = apiLevel(projectCfg.MinSDKVersion)
+	}
+	if opts.ABI == "" {
+		return target{}, fmt.Errorf("the required flag `-a, --abi' was not specified")
+	}
+	if opts.MinSDKVersion == 0 {
+		return target{}, fmt.Errorf("the required flag `-s, --min-sdk-version' was not specified")
+	}
+	// Per-ABI settings in the config are looked up by this name. ABIs newer
+	// than ndkenv may still be found in the NDK's metadata.
+	canonical, abiErr := canonicalABI(opts.ABI)
+	if abiErr == nil {
+		opts.ABI = canonical
+	}
+
+	if err = locateNDK(projectCfg, projectLock); err != nil {
+		return target{}, err
+	}
+
+	t := target{api: int(opts.MinSDKVersion), ndk: opts.NDK}
+	if abiErr == nil {
+		t.ABI, _ = ndkenv.LookupABI(opts.ABI)
+	} else if t.ABI, err = metaABI(t.ndk, opts.ABI); err != nil {
+		return target{}, abiErr
+	}
+	if opts.MinSDKVersion == projectSDK {
+		if t.api, err = projectMinSDK(); err != nil {
+			return target{}, err
+		}
+	}
+	if opts.MinSDKVersion == autoSDK {
+		if t.api, err = minSDKFloor(t.ndk, t.ABI); err != nil {
+			return target{}, err
+		}
+		if t.api == 0 {
+			return target{}, fmt.Errorf("-s auto needs the NDK's meta/platforms.json, which NDK %s predates, pass the min SDK version instead", t.ndk)
+		}
+		verbosef("Using min SDK version %d, the lowest the NDK supports for %s", t.api, t.Name)
+	}
+	cpuFlags, err := t.selectCPU()
+	if err != nil {
+		return target{}, err
+	}
+	if t.api, err = checkMinSDK(t.ndk, t.ABI, t.api); err != nil {
+		return target{}, err
+	}
+	settings, err := projectCfg.settings(opts.Profile)
+	if err != nil {
+		return target{}, err
+	}
+	t.flags = settings.flagsFor(opts.ABI, t.api)
+	for _, aar := range append(settings.Prefab, opts.Prefab...) {
+		flags, err := prefabFlags(aar, t.Name, t.api)
+		if err != nil {
+			return target{}, fmt.Errorf("prefab %s: %w", aar, err)
+		}
+		t.flags = t.flags.merge(flags)
+	}
+	t.flags = t.flags.merge(flagSet{CFlags: cpuFlags})
+	t.link = append(settings.Link, opts.Link...)
+	for _, lib := range t.link {
+		t.flags = t.flags.merge(flagSet{LDFlags: []string{"-l" + lib}})
+	}
+	t.postBuild = settings.PostBuild
+	t.outDir = settings.OutDir
+	if t.extraEnv, err = extraEnv(settings.Env); err != nil {
+		return target{}, err
+	}
+
+	nt := t.ndkConfig()
+	if nt.HostTag, err = ndkHostTag(t.ndk); err != nil {
+		// Files generated for containers relocate the toolchain anyway, so
+		// only fail once this host's toolchain is needed
+		t.hostErr, nt.HostTag = err, "linux-x86_64"
+	}
+	t.toolchain = nt.Toolchain()
+	t.sysroot = nt.Sysroot()
+	t.iSystem = nt.ISystem()
+	t.clang = nt.Clang()
+	return t, nil
+}
+
+// projectMinSDK returns the min SDK version of the Android project surrounding
+// the working dir, for -s project
+func projectMinSDK() (int, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+	p, err := findAndroidProject(wd)
+	if err != nil {
+		return 0, fmt.Errorf("-s project: %w", err)
+	}
+	api, path, err := p.minSDK()
+	if err != nil {
+		return 0, fmt.Errorf("-s project: %w", err)
+	}
+	verbosef("Using min SDK version %d, from %s", api, path)
+	return api, nil
+}
+
+// forEachABI calls fn with each ABI given to --abi selected in turn, or just
+// once with the project config's ABI if there weren't any
+func forEachABI(fn func(spec string) error) error {
+	specs := abiSpecs()
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+	minSDKVersion := opts.MinSDKVersion
+	for _, spec := range specs {
+		opts.ABI, opts.MinSDKVersion = "", minSDKVersion
+		if spec != "" {
+			if err := selectABI(spec); err != nil {
+				return err
+			}
+		}
+		if err := fn(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// abiSpecs returns the ABIs given to --abi (or abis in the config), with all replaced by every ABI,
+// keeping its min SDK version if it has one, e.g. all:21
+func abiSpecs() []string {
+	given := opts.ABIs
+	if len(given) == 0 {
+		// Errors loading the config are reported once the target is resolved
+		projectCfg, _, _ := loadProject()
+		given = projectCfg.ABIs
+	}
+	var specs []string
+	for _, spec := range given {
+		abi, version, hasVersion := strings.Cut(spec, ":")
+		if abi != "all" {
+			specs = append(specs, spec)
+			continue
+		}
+		for _, name := range ndkenv.ABINames {
+			if hasVersion {
+				name += ":" + version
+			}
+			specs = append(specs, name)
+		}
+	}
+	return specs
+}
+
+// selectABI targets the ABI given to --abi, along with its min SDK version for
+// a spec of the form abi:version
+func selectABI(spec string) error {
+	abi, version, ok := strings.Cut(spec, ":")
+	if ok {
+		api, err := strconv.Atoi(version)
+		if err != nil || api < 1 {
+			return fmt.Errorf("invalid --abi %s: expected abi:version, e.g. arm64-v8a:21", spec)
+		}
+		opts.MinSDKVersion = apiLevel(api)
+	}
+	opts.ABI = abi
+	return nil
+}
+
+// canonicalABI returns the name ndkenv uses for the ABI called abi, like
+// ndkenv.CanonicalABIName, suggesting the ABI meant if abi is a typo
+func canonicalABI(abi string) (string, error) {
+	canonical, err := ndkenv.CanonicalABIName(abi)
+	if err != nil {
+		names := append([]string{"armeabi"}, ndkenv.ABINames...)
+		for alias := range ndkenv.ABIAliases {
+			names = append(names, alias)
+		}
+		sort.Strings(names)
+		if s := suggest(strings.ToLower(abi), names); s != "" {
+			if canonical, ok := ndkenv.ABIAliases[s]; ok {
+				s = canonical
+			}
+			return "", fmt.Errorf("%w (did you mean %s?)", err, s)
+		}
+	}
+	return canonical, err
+}
+
+// expand replaces {abi} and {api} in s with t's ABI and API level, so that each
+// ABI of a multi-ABI run can write to its own files, and {out} with its out dir
+func (t target) expand(s string) string {
+	if t.outDir != "" {
+		s = strings.ReplaceAll(s, "{out}", t.outDir)
+	}
+	return strings.NewReplacer("{abi}", t.Name, "{api}", strconv.Itoa(t.api)).Replace(s)
+}
+
+func (t target) expandArgs(args []string) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = t.expand(arg)
+	}
+	return expanded
+}
+
+// check looks for the parts of the NDK that t needs, so that a broken or
+// minimal NDK is reported up front rather than by cgo partway through a build
+func (t target) check() error {
+	if t.hostErr != nil {
+		return t.hostErr
+	}
+	version, _ := ndkVersion(t.ndk)
+	if version == "" {
+		version = t.ndk
+	}
+	switch {
+	case !isDir(t.toolchain):
+		return t.missingToolchain(version)
+	case !isFile(t.clang):
+		return fmt.Errorf("clang not found at %s, NDK %s is incomplete", t.clang, version)
+	case !isDir(t.sysroot):
+		return fmt.Errorf("sysroot not found at %s, NDK %s is incomplete", t.sysroot, version)
+	case !isDir(t.iSystem):
+		arch, _, _ := strings.Cut(t.Triple, "-")
+		return fmt.Errorf("sysroot headers for %s missing at %s, is NDK %s a minimal NDK?", arch, t.iSystem, version)
+	}
+	if t.Name == "armeabi" {
+		if abis, err := readNDKABIs(t.ndk); err == nil {
+			if _, ok := abis["armeabi"]; !ok {
+				return fmt.Errorf("NDK %s doesn't support armeabi, which was removed in NDK r17, use NDK r16b or earlier", version)
+			}
+		}
+	}
+	// Otherwise the build only fails once it gets to linking
+	libs := t.libDir()
+	for _, lib := range t.link {
+		if !isFile(filepath.Join(libs, "lib"+lib+".so")) && !isFile(filepath.Join(libs, "lib"+lib+".a")) {
+			return fmt.Errorf("can't link against %s, NDK %s has no lib%s.so for %s at API level %d in %s", lib, version, lib, t.Name, t.api, libs)
+		}
+	}
+	return nil
+}
+
+// libDir returns the sysroot's directory of Android's libraries for t's ABI at
+// its API level, e.g. liblog.so
+func (t target) libDir() string {
+	return filepath.Join(t.sysroot, "usr", "lib", t.Headers, strconv.Itoa(t.api))
+}
+
+// missingToolchain explains why the NDK has no toolchain for this host
+func (t target) missingToolchain(version string) error {
+	prebuilt := filepath.Dir(t.toolchain)
+	entries, err := os.ReadDir(prebuilt)
+	if err != nil {
+		return fmt.Errorf("no toolchains found in %s, is %s an NDK?", prebuilt, t.ndk)
+	}
+	var hostTags []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			hostTags = append(hostTags, entry.Name())
+		}
+	}
+	hostTag := filepath.Base(t.toolchain)
+	if len(hostTags) == 0 {
+		return fmt.Errorf("no toolchains found in %s, is %s an NDK?", prebuilt, t.ndk)
+	}
+	msg := fmt.Sprintf("NDK %s has no toolchain for this host (%s/%s, host tag %s), only for %s.",
+		version, runtime.GOOS, runtime.GOARCH, hostTag, strings.Join(hostTags, ", "))
+	switch {
+	case opts.HostTag != "":
+		msg += "\nPass one of those to --host-tag instead"
+	case runtime.GOARCH == "amd64" || runtime.GOOS == "darwin":
+		// Apple Silicon runs the x86_64 toolchain with Rosetta
+		msg += fmt.Sprintf("\nNDKs are downloaded per host OS, use the NDK for %s instead", runtime.GOOS)
+	default:
+		msg += "\nThe NDK only provides x86_64 toolchains, run ndkenv under x86_64 emulation instead, e.g. in a linux/amd64 container"
+	}
+	return errors.New(msg)
+}
+
+// ndkConfig returns t as an ndkenv.Config, without any of its extra flags
+func (t target) ndkConfig() ndkenv.Config {
+	return ndkenv.Config{ABI: t.ABI, MinSDK: t.api, NDK: t.ndk, HostTag: filepath.Base(t.toolchain)}
+}
+
+// env returns the variables to set when building for t, as KEY=VALUE.
+// getenv looks up the caller's existing value of a variable, so that flags
+// they've already set are kept.
+func (t target) env(getenv func(string) string) []string {
+	nt := t.ndkConfig()
+	// Prefab's include and lib directories are in the cache, which may have spaces
+	nt.CPPFlags = withExisting(quoteAll(t.flags.cppflags()), getenv("CGO_CPPFLAGS"))
+	nt.CFlags = withExisting(t.flags.CFlags, getenv("CGO_CFLAGS"))
+	nt.LDFlags = withExisting(quoteAll(t.flags.LDFlags), getenv("CGO_LDFLAGS"))
+	env := nt.Env()
+	for _, kv := range t.extraEnv {
+		env = setEnv(env, t.expand(kv))
+	}
+	return env
+}
+
+// quoteAll returns flags with each quoted, if need be, to be joined into a
+// CGO_*FLAGS variable as one argument
+func quoteAll(flags []string) []string {
+	quoted := make([]string, len(flags))
+	for i, flag := range flags {
+		quoted[i] = ndkenv.Quote(flag)
+	}
+	return quoted
+}
+
+// extraEnv returns the variables set in the config, by name, followed by those
+// passed to --env, which replace any of the same name
+func extraEnv(configEnv map[string]string) ([]string, error) {
+	var env []string
+	for name, value := range configEnv {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	for _, kv := range opts.Env {
+		if name, _, ok := strings.Cut(kv, "="); !ok || name == "" {
+			return nil, fmt.Errorf("--env %s: expected KEY=VALUE, e.g. OPENSSL_DIR=/opt/openssl", kv)
+		}
+		env = append(env, kv)
+	}
+	return env, nil
+}
+
+// setEnv sets kv, a KEY=VALUE, in env, replacing any existing value of KEY
+func setEnv(env []string, kv string) []string {
+	name, _, _ := strings.Cut(kv, "=")
+	for i, existing := range env {
+		if strings.HasPrefix(existing, name+"=") {
+			env[i] = kv
+			return env
+		}
+	}
+	return append(env, kv)
+}
+
+// pathEnv returns PATH with the toolchain's bin directory in front, so that
+// clang, llvm-strip and the target-prefixed clang wrappers run by name are the
+// NDK's rather than the host's
+func (t target) pathEnv() string {
+	return "PATH=" + filepath.Join(t.toolchain, "bin") + string(os.PathListSeparator) + inheritedGetenv("PATH")
+}
+
+// respectEnv removes the variables named in names from env wherever the user
+// has already set them, warning that their value is kept instead of ndkenv's
+func respectEnv(env []string, names []string) []string {
+	var ours []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		ours = append(ours, name)
+	}
+	for _, name := range names {
+		// Likely a typo, though some variables are only set for some targets,
+		// and --isolate keeps others than ndkenv's
+		if _, set := os.LookupEnv(name); !contains(ours, name) && !(opts.Isolate && set) {
+			warnf("--respect-env: %s isn't set by ndkenv for this target, which sets: %s",
+				name, strings.Join(ours, ", "))
+		}
+	}
+	var kept []string
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if existing, ok := os.LookupEnv(name); ok && contains(names, name) {
+			if existing != value {
+				warnf("using %s=%s from the environment, rather than %s", name, existing, value)
+			}
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	return kept
+}
+
+// Variables that, set in the environment, would change what's built if
+// ndkenv's values didn't replace them
+var conflictingEnv = []string{"GOOS", "GOARCH", "GOARM", "CC", "CGO_ENABLED"}
+
+// checkConflicts warns about variables in conflictingEnv that the environment
+// sets to something other than their value in env, which replaces it, or with
+// --strict fails, so a build can't depend on what the caller happens to set
+func checkConflicts(env []string) error {
+	var conflicts []string
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		existing, set := os.LookupEnv(name)
+		if !set || existing == value || !contains(conflictingEnv, name) || !isInherited(name) {
+			continue
+		}
+		conflicts = append(conflicts, name+"="+existing)
+		if !opts.Strict {
+			warnf("overriding %s=%q from the environment with %q, pass --respect-env %s to keep it", name, existing, value, name)
+		}
+	}
+	if opts.Strict && len(conflicts) > 0 {
+		return fmt.Errorf("--strict: the environment sets %s, which ndkenv would override. Unset them, or pass --respect-env to keep them",
+			strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// relocate replaces t's NDK paths in value with their equivalents for an NDK
+// installed at ndk on a host with the given host tag, e.g. for generating
+// files used in containers
+func (t target) relocate(value, ndk, hostTag string) string {
+	toolchain := filepath.Join(ndk, "toolchains", "llvm", "prebuilt", hostTag)
+	value = strings.ReplaceAll(value, t.toolchain, filepath.ToSlash(toolchain))
+	return strings.ReplaceAll(value, t.ndk, filepath.ToSlash(ndk))
+}
+
+// noEnv is passed to target.env when generating files, which shouldn't capture
+// whatever happens to be set in the current environment
+func noEnv(string) string {
+	return ""
+}
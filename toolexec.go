@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type toolexecCommand struct {
+	Log string `long:"log" env:"NDKENV_TOOLEXEC_LOG" value-name:"FILE" description:"Append each tool invocation to FILE as a line of JSON"`
+}
+
+// toolRun is logged for each tool invocation
+type toolRun struct {
+	Tool            string   `json:"tool"`
+	Package         string   `json:"package,omitempty"`
+	GOOS            string   `json:"goos"`
+	GOARCH          string   `json:"goarch"`
+	Args            []string `json:"args"`
+	ExitCode        int      `json:"exit_code"`
+	DurationSeconds float64  `json:"duration_seconds"`
+}
+
+// Execute runs the tool go build passes after the options, e.g. ndkenv toolexec
+// /usr/local/go/pkg/tool/linux_amd64/compile -o ..., exiting with its exit code
+func (c *toolexecCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return errors.New("toolexec needs a tool to run, use it as go build -toolexec \"ndkenv toolexec\"")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	start := time.Now()
+	err := cmd.Run()
+	run := toolRun{
+		Tool:            strings.TrimSuffix(filepath.Base(args[0]), ".exe"),
+		GOOS:            os.Getenv("GOOS"),
+		GOARCH:          os.Getenv("GOARCH"),
+		Args:            args[1:],
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		run.ExitCode = exitError.ExitCode()
+	} else if err != nil {
+		return err
+	}
+	for i, arg := range run.Args {
+		if arg == "-p" && i+1 < len(run.Args) {
+			run.Package = run.Args[i+1]
+		}
+	}
+
+	// go build asks each tool for its version to key the build cache, which
+	// isn't an invocation worth logging
+	if c.Log != "" && !(len(run.Args) == 1 && strings.HasPrefix(run.Args[0], "-V")) {
+		if err = appendJSONLine(c.Log, run); err != nil {
+			return err
+		}
+	}
+	os.Exit(run.ExitCode)
+	return nil
+}
+
+// appendJSONLine appends v to path as a line of JSON. Tools run in parallel,
+// so the line is written with a single append.
+func appendJSONLine(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return appendFile(path, append(data, '\n'))
+}
+
+// appendFile appends data to path, creating it if needed
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// traceArgs adds -x and -work to a go command, so that it prints every command
+// it runs and keeps its work directory around for inspection afterwards
+func traceArgs(args []string) ([]string, error) {
+	if len(args) < 2 || !isGoCommand(args) {
+		return nil, errors.New("--trace-toolchain needs a go command to trace, e.g. go build .")
+	}
+	return append([]string{args[0], args[1], "-x", "-work"}, args[2:]...), nil
+}
+
+// toolchainTracer parses the commands printed by go build -x as they're written,
+// logging each invocation of the C toolchain or Go tools as a line of JSON
+type toolchainTracer struct {
+	path        string
+	clang       string
+	log         *os.File
+	enc         *json.Encoder
+	line        []byte // Incomplete last line written
+	dir         string // Working directory, as of the last cd
+	work        string // Work directory of the build, i.e. $WORK
+	heredoc     string // Terminator of the heredoc being skipped over, if any
+	invocations []invocation
+}
+
+type invocation struct {
+	Tool string   `json:"tool"`
+	Mode string   `json:"mode,omitempty"` // For clang, whether it's compiling or linking
+	Dir  string   `json:"dir,omitempty"`
+	Args []string `json:"args"`
+}
+
+func newToolchainTracer(path string, t target) (*toolchainTracer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &toolchainTracer{path: path, clang: t.clang, log: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (t *toolchainTracer) Write(p []byte) (int, error) {
+	t.line = append(t.line, p...)
+	for {
+		i := strings.IndexByte(string(t.line), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := t.parseLine(string(t.line[:i])); err != nil {
+			return 0, err
+		}
+		t.line = t.line[i+1:]
+	}
+}
+
+func (t *toolchainTracer) parseLine(line string) error {
+	switch {
+	case t.heredoc != "":
+		if line == t.heredoc {
+			t.heredoc = ""
+		}
+		return nil
+	case strings.HasPrefix(line, "WORK="):
+		t.work = strings.TrimPrefix(line, "WORK=")
+		return nil
+	case strings.Contains(line, "<< '"):
+		// Files written by the build, e.g. cat >$WORK/b001/importcfg << 'EOF'
+		t.heredoc, _, _ = strings.Cut(line[strings.Index(line, "<< '")+4:], "'")
+		return nil
+	}
+
+	args, err := splitArgs(line)
+	if err != nil || len(args) == 0 {
+		return nil // Output of the build, rather than a command
+	}
+	if args[0] == "cd" && len(args) == 2 {
+		t.dir = args[1]
+		return nil
+	}
+	// Skip over variables set for the command, e.g. TERM='dumb' ... cgo
+	for len(args) > 0 && strings.Contains(args[0], "=") && !strings.HasPrefix(args[0], "-") {
+		args = args[1:]
+	}
+	// e.g. "/usr/local/go/pkg/tool/linux_amd64/link: running clang failed"
+	if len(args) == 0 || strings.HasSuffix(args[0], ":") {
+		return nil
+	}
+
+	inv := invocation{Dir: t.dir, Args: args[1:]}
+	switch name := strings.TrimSuffix(filepath.Base(args[0]), ".exe"); {
+	case args[0] == t.clang || name == "clang" || name == "clang++":
+		inv.Tool, inv.Mode = "clang", "link"
+		if contains(inv.Args, "-c") || contains(inv.Args, "-E") {
+			inv.Mode = "compile"
+		}
+	case strings.Contains(filepath.ToSlash(args[0]), "/pkg/tool/"):
+		// Go's own tools, e.g. compile, link and cgo
+		inv.Tool = name
+	default:
+		return nil
+	}
+	t.invocations = append(t.invocations, inv)
+	return t.enc.Encode(inv)
+}
+
+// Close parses anything left over and closes the log
+func (t *toolchainTracer) Close() error {
+	if len(t.line) > 0 {
+		if err := t.parseLine(string(t.line)); err != nil {
+			t.log.Close()
+			return err
+		}
+	}
+	return t.log.Close()
+}
+
+// Flags whose value is passed as a separate argument
+var separateValueFlags = map[string]bool{
+	"-target": true, "-I": true, "-isystem": true, "-L": true, "-include": true,
+	"-o": true, "-x": true, "-Xlinker": true,
+}
+
+// perInvocation reports whether flag differs from one invocation to the next,
+// e.g. the output file, so isn't worth including in a summary
+func perInvocation(flag string) bool {
+	return flag == "-c" || strings.HasPrefix(flag, "-o ") ||
+		strings.HasPrefix(flag, "-frandom-seed=") || strings.Contains(flag, "$WORK")
+}
+
+// summarize writes how many times each tool was run and the distinct flags clang was run with
+func (t *toolchainTracer) summarize(w io.Writer) {
+	fmt.Fprintf(w, "Toolchain trace: %d invocations, logged to %s\n", len(t.invocations), t.path)
+	if len(t.invocations) == 0 {
+		fmt.Fprintln(w, "  Packages that are already in the build cache aren't rebuilt, pass -a to rebuild everything")
+	}
+
+	var names []string
+	counts := make(map[string]int)
+	flags := make(map[string][]string)
+	for _, inv := range t.invocations {
+		name := inv.Tool
+		if inv.Mode != "" {
+			name += " (" + inv.Mode + ")"
+		}
+		if counts[name] == 0 {
+			names = append(names, name)
+		}
+		counts[name]++
+		if inv.Tool == "clang" {
+			for i := 0; i < len(inv.Args); i++ {
+				flag := inv.Args[i]
+				if !strings.HasPrefix(flag, "-") {
+					continue
+				}
+				if separateValueFlags[flag] && i+1 < len(inv.Args) {
+					i++
+					flag += " " + inv.Args[i]
+				}
+				if !perInvocation(flag) && !contains(flags[name], flag) {
+					flags[name] = append(flags[name], flag)
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %d\n", name, counts[name])
+	}
+	for _, name := range names {
+		if len(flags[name]) > 0 {
+			fmt.Fprintf(w, "Flags passed to %s:\n  %s\n", name, strings.Join(flags[name], " "))
+		}
+	}
+	if t.work != "" {
+		fmt.Fprintf(w, "Work directory ($WORK) kept at %s\n", t.work)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+type tripleCommand struct {
+	API bool `long:"api" description:"Suffix the triple with the min SDK version, as in the names of the NDK's clang wrappers, e.g. aarch64-linux-android21"`
+}
+
+func (c *tripleCommand) Execute([]string) error {
+	return forEachABI(func(string) error {
+		t, err := resolve()
+		if err != nil {
+			return err
+		}
+		if c.API {
+			fmt.Printf("%s%d\n", t.Triple, t.api)
+		} else {
+			fmt.Println(t.Triple)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type useCommand struct{}
+
+// configKey is a top-level config key, with its value already encoded as TOML
+type configKey struct {
+	name  string
+	value string
+}
+
+func (c *useCommand) Execute([]string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path := findConfig(wd)
+	if path == "" {
+		path = filepath.Join(wd, configFileName)
+	}
+
+	// Only what was passed on the command line is saved, so look at opts
+	// before resolve fills in the rest from the existing config
+	specs := abiSpecs()
+	if len(specs) > 1 {
+		return fmt.Errorf("only one --abi can be saved, got %s", strings.Join(specs, ", "))
+	}
+	if len(specs) == 1 {
+		if err = selectABI(specs[0]); err != nil {
+			return err
+		}
+	}
+	var keys []configKey
+	if opts.ABI != "" {
+		keys = append(keys, configKey{"abi", strconv.Quote(opts.ABI)})
+	}
+	if opts.MinSDKVersion < 0 {
+		return errors.New("-s auto and -s project can't be saved as the project default, pass the min SDK version instead")
+	}
+	if opts.MinSDKVersion != 0 {
+		keys = append(keys, configKey{"min_sdk_version", strconv.Itoa(int(opts.MinSDKVersion))})
+	}
+	if opts.NDK != "" {
+		ndk, err := configRelPath(path, opts.NDK)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, configKey{"ndk", strconv.Quote(ndk)})
+	}
+	if opts.NDKArchive != "" {
+		archive, err := configRelPath(path, opts.NDKArchive)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, configKey{"ndk_archive", strconv.Quote(archive)})
+	}
+	if opts.NDKVersion != "" {
+		keys = append(keys, configKey{"ndk_version", strconv.Quote(opts.NDKVersion)})
+	}
+	if len(keys) == 0 {
+		return errors.New("nothing to save, pass at least one of --abi, --min-sdk-version, --ndk, --ndk-archive or --ndk-version")
+	}
+	if err = setConfigKeys(path, keys); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	// Resolve afresh, rather than sticking to the version in the old lock
+	if err = os.Remove(lockPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	version, err := ndkVersion(t.ndk)
+	if err != nil {
+		return fmt.Errorf("reading NDK version: %w", err)
+	}
+	if err = writeLock(lockPath(path), lock{NDKVersion: version, Constraint: opts.NDKVersion}); err != nil {
+		return fmt.Errorf("writing %s: %w", lockPath(path), err)
+	}
+	infof("Using %s with min SDK version %d and NDK %s", opts.ABI, t.api, version)
+	return nil
+}
+
+// configRelPath returns path relative to the config file at configPath, as paths
+// in the config are relative to it rather than to the working dir. Paths outside
+// the config's directory are made absolute instead.
+func configRelPath(configPath, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(filepath.Dir(configPath), abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel, nil
+	}
+	return abs, nil
+}
+
+// setConfigKeys sets top-level keys in the config file at path, creating the
+// file if needed. The rest of the file, including comments, is left alone.
+func setConfigKeys(path string, keys []configKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	// Top-level keys must come before the first table
+	end := len(lines)
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "[") {
+			end = i
+			break
+		}
+	}
+	for _, key := range keys {
+		line := key.name + " = " + key.value
+		found := false
+		for i := 0; i < end && !found; i++ {
+			if name, _, ok := strings.Cut(lines[i], "="); ok && strings.TrimSpace(name) == key.name {
+				lines[i] = line
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		// Add new keys after the last top-level key, rather than after any
+		// blank lines or comments leading up to the first table
+		at := end
+		for at > 0 && strings.TrimSpace(lines[at-1]) == "" {
+			at--
+		}
+		lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+		end++
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
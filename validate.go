@@ -0,0 +1,447 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configError is a problem with a config file, located by line where possible
+type configError struct {
+	path string
+	line int
+	msg  string
+}
+
+func (e configError) Error() string {
+	if e.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+	}
+	return fmt.Sprintf("%s: %s", e.path, e.msg)
+}
+
+// configErrors are all the problems found in a config file, so they can be
+// fixed in one go rather than one run at a time
+type configErrors []configError
+
+func (e configErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// validate checks for mistakes that decoding alone doesn't catch, such as
+// misspelt keys and unknown ABIs, and parses the API constraints of conditions.
+func (c *config) validate(src configSource, md toml.MetaData) configErrors {
+	var errs configErrors
+
+	// Report each unknown key once, rather than once for every key nested below it
+	var reported []toml.Key
+undecoded:
+	for _, key := range md.Undecoded() {
+		for _, r := range reported {
+			if len(key) >= len(r) && key[:len(r)].String() == r.String() {
+				continue undecoded
+			}
+		}
+		reported = append(reported, key)
+		msg := fmt.Sprintf("unknown key %s", key)
+		if s := suggest(key[len(key)-1], knownKeys(reflect.TypeOf(*c), key[:len(key)-1])); s != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", s)
+		}
+		errs = append(errs, src.errorf(key, 0, "%s", msg))
+	}
+
+	if c.ABI != "" {
+		if _, err := canonicalABI(c.ABI); err != nil {
+			errs = append(errs, src.errorf(toml.Key{"abi"}, 0, "%s", err))
+		}
+	}
+	for _, spec := range c.ABIs {
+		abi, version, hasVersion := strings.Cut(spec, ":")
+		if api, err := strconv.Atoi(version); hasVersion && (err != nil || api < 1) {
+			errs = append(errs, src.errorf(toml.Key{"abis"}, 0, "invalid abi %s: expected abi:version, e.g. arm64-v8a:21", spec))
+		} else if _, err := canonicalABI(abi); err != nil && abi != "all" && abi != hostABI {
+			errs = append(errs, src.errorf(toml.Key{"abis"}, 0, "%s", err))
+		}
+	}
+	if md.IsDefined("min_sdk_version") && c.MinSDKVersion < 1 {
+		errs = append(errs, src.errorf(toml.Key{"min_sdk_version"}, 0,
+			"min_sdk_version must be a positive API level, got %d", c.MinSDKVersion))
+	}
+	if args, err := splitArgs(c.Command); err != nil {
+		errs = append(errs, src.errorf(toml.Key{"command"}, 0, "command: %s", err))
+	} else if md.IsDefined("command") && len(args) == 0 {
+		errs = append(errs, src.errorf(toml.Key{"command"}, 0, "command is empty"))
+	}
+	var commands []string
+	for name := range c.Commands {
+		commands = append(commands, name)
+	}
+	sort.Strings(commands)
+	for _, name := range commands {
+		if args, err := splitArgs(c.Commands[name]); err != nil {
+			errs = append(errs, src.errorf(toml.Key{"commands", name}, 0, "command %s: %s", name, err))
+		} else if len(args) == 0 {
+			errs = append(errs, src.errorf(toml.Key{"commands", name}, 0, "command %s is empty", name))
+		}
+	}
+	errs = append(errs, c.buildSettings.validate(src, nil)...)
+
+	var names []string
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	extendsOK := true
+	for _, name := range names {
+		p := c.Profiles[name]
+		errs = append(errs, p.buildSettings.validate(src, toml.Key{"profile", name})...)
+		if _, ok := c.Profiles[p.Extends]; p.Extends != "" && !ok {
+			msg := fmt.Sprintf("profile %s extends unknown profile %s", name, p.Extends)
+			if s := suggest(p.Extends, names); s != "" {
+				msg += fmt.Sprintf(" (did you mean %s?)", s)
+			}
+			errs = append(errs, src.errorf(toml.Key{"profile", name, "extends"}, 0, "%s", msg))
+			extendsOK = false
+		}
+	}
+	// With every parent known to exist, the only way to fail is a cycle
+	if extendsOK {
+		for _, name := range names {
+			if _, err := c.settings(name); err != nil {
+				errs = append(errs, src.errorf(toml.Key{"profile", name, "extends"}, 0, "%s", err))
+			}
+		}
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].line < errs[j].line })
+	return errs
+}
+
+func (s *buildSettings) validate(src configSource, prefix toml.Key) configErrors {
+	var errs configErrors
+	var abis []string
+	for abi := range s.Targets {
+		abis = append(abis, abi)
+	}
+	sort.Strings(abis)
+	for _, abi := range abis {
+		if err := checkABIKey(abi); err != nil {
+			errs = append(errs, src.errorf(appendKey(prefix, "target", abi), 0, "%s", err))
+		}
+	}
+	if p := s.PostBuild; p != nil {
+		key := appendKey(prefix, "post_build")
+		if p.Artifact == "" && len(p.Steps) > 0 {
+			errs = append(errs, src.errorf(key, 0, "post_build needs the artifact to run its steps on"))
+		}
+		for _, step := range p.Steps {
+			if !contains(postBuildSteps, step) {
+				msg := fmt.Sprintf("unknown post_build step %s", step)
+				if s := suggest(step, postBuildSteps); s != "" {
+					msg += fmt.Sprintf(" (did you mean %s?)", s)
+				} else {
+					msg += fmt.Sprintf(", expected one of: %s", strings.Join(postBuildSteps, ", "))
+				}
+				errs = append(errs, src.errorf(appendKey(key, "steps"), 0, "%s", msg))
+			}
+		}
+	}
+	for i := range s.Conditional {
+		when := &s.Conditional[i].When
+		key := appendKey(prefix, "conditional", "when")
+		if when.ABI != "" {
+			if err := checkABIKey(when.ABI); err != nil {
+				errs = append(errs, src.errorf(appendKey(key, "abi"), i, "%s", err))
+			}
+		}
+		var err error
+		if when.api, err = parseAPIConstraint(when.API); err != nil {
+			errs = append(errs, src.errorf(appendKey(key, "api"), i, "%s", err))
+		}
+	}
+	return errs
+}
+
+// configSource locates keys within the text of a config file. It's a rough
+// line-based scan rather than a full TOML parser, which is plenty for pointing
+// at the line a key was defined on.
+type configSource struct {
+	path string
+	// The line each key was defined on, by index of the array of tables
+	// element it's in (always 0 outside of arrays of tables)
+	lines map[string]map[int]int
+}
+
+func newConfigSource(path string, data []byte) configSource {
+	src := configSource{path: path, lines: make(map[string]map[int]int)}
+	var table toml.Key
+	var nth int               // Index of the current array of tables element
+	elems := map[string]int{} // Number of elements seen in each array of tables
+	depth := 0                // Depth of the multi-line array currently being skipped over
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if j := indexUnquoted(line, '#'); j >= 0 {
+			line = line[:j]
+		}
+		if depth > 0 {
+			depth += bracketDepth(line)
+			continue
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "[["):
+			table = parseKey(strings.TrimSuffix(strings.TrimPrefix(line, "[["), "]]"))
+			nth = elems[table.String()]
+			elems[table.String()]++
+			src.add(table, nth, i+1)
+		case strings.HasPrefix(line, "["):
+			table = parseKey(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			nth = 0
+			src.add(table, nth, i+1)
+		default:
+			j := indexUnquoted(line, '=')
+			if j < 0 {
+				continue
+			}
+			src.add(appendKey(table, parseKey(line[:j])...), nth, i+1)
+			depth = bracketDepth(line[j+1:])
+		}
+	}
+	return src
+}
+
+func (s configSource) add(key toml.Key, nth int, line int) {
+	k := key.String()
+	if s.lines[k] == nil {
+		s.lines[k] = make(map[int]int)
+	}
+	if _, ok := s.lines[k][nth]; !ok {
+		s.lines[k][nth] = line
+	}
+}
+
+// line returns the line key is defined on within the nth element of its array of
+// tables, or the line of its closest parent if the key itself wasn't found
+// (e.g. it's part of an inline table). Returns 0 if nothing was found.
+func (s configSource) line(key toml.Key, nth int) int {
+	for ; len(key) > 0; key = key[:len(key)-1] {
+		if line, ok := s.lines[key.String()][nth]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+func (s configSource) errorf(key toml.Key, nth int, format string, args ...interface{}) configError {
+	return configError{path: s.path, line: s.line(key, nth), msg: fmt.Sprintf(format, args...)}
+}
+
+// Type mismatches are reported without a position, with the line in the message instead
+var lastKeyError = regexp.MustCompile(`^toml: line (\d+) \(last key "(.*)"\): (.*)$`)
+
+// decodeError converts an error from the toml package into a configError
+func (s configSource) decodeError(err error) error {
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		return configError{path: s.path, line: pe.Position.Line, msg: pe.Message}
+	}
+	if m := lastKeyError.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return configError{path: s.path, line: line, msg: m[2] + ": " + m[3]}
+	}
+	return configError{path: s.path, msg: err.Error()}
+}
+
+// parseKey splits a (possibly dotted and quoted) TOML key into its parts
+func parseKey(s string) toml.Key {
+	var key toml.Key
+	for {
+		i := indexUnquoted(s, '.')
+		part := s
+		if i >= 0 {
+			part = s[:i]
+		}
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '"' || part[0] == '\'') && part[len(part)-1] == part[0] {
+			part = part[1 : len(part)-1]
+		}
+		key = append(key, part)
+		if i < 0 {
+			return key
+		}
+		s = s[i+1:]
+	}
+}
+
+// appendKey returns a new key with parts appended to key
+func appendKey(key toml.Key, parts ...string) toml.Key {
+	return append(key[:len(key):len(key)], parts...)
+}
+
+// indexUnquoted is like strings.IndexByte, but ignores c inside quoted strings
+func indexUnquoted(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == 0 && s[i] == c:
+			return i
+		case quote == 0 && (s[i] == '"' || s[i] == '\''):
+			quote = s[i]
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			quote = 0
+		}
+	}
+	return -1
+}
+
+// bracketDepth returns how many more [ than ] there are in s, outside quoted strings
+func bracketDepth(s string) int {
+	depth := 0
+	for {
+		open, close := indexUnquoted(s, '['), indexUnquoted(s, ']')
+		switch {
+		case open >= 0 && (close < 0 || open < close):
+			depth++
+			s = s[open+1:]
+		case close >= 0:
+			depth--
+			s = s[close+1:]
+		default:
+			return depth
+		}
+	}
+}
+
+// tomlName returns the key name a struct field is decoded from
+func tomlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// tomlFields returns the fields of struct type t that are decoded from TOML,
+// including those promoted from embedded structs
+func tomlFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		switch {
+		case f.Anonymous && f.Type.Kind() == reflect.Struct:
+			fields = append(fields, tomlFields(f.Type)...)
+		case f.PkgPath == "" && tomlName(f) != "-":
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// knownKeys returns the names of the keys that can be defined directly below key,
+// when decoding into type t
+func knownKeys(t reflect.Type, key toml.Key) []string {
+	elem := func(t reflect.Type) reflect.Type {
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		return t
+	}
+	for _, part := range key {
+		switch t = elem(t); t.Kind() {
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Struct:
+			var found bool
+			for _, f := range tomlFields(t) {
+				if tomlName(f) == part {
+					t, found = f.Type, true
+					break
+				}
+			}
+			if !found {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+	if t = elem(t); t.Kind() != reflect.Struct {
+		return nil
+	}
+	var names []string
+	for _, f := range tomlFields(t) {
+		names = append(names, tomlName(f))
+	}
+	return names
+}
+
+// checkABIKey fails unless abi is an ABI's name as ndkenv uses it, which
+// per-ABI settings are matched against
+func checkABIKey(abi string) error {
+	canonical, err := canonicalABI(abi)
+	if err == nil && canonical != abi {
+		err = fmt.Errorf("%s is another name for %s, use that here", abi, canonical)
+	}
+	return err
+}
+
+// suggest returns the candidate closest to s, if it's close enough to s
+// that s is likely to be a typo of it. Returns "" otherwise.
+func suggest(s string, candidates []string) string {
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		if d := editDistance(s, c); bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if bestDist < 0 || (bestDist > 2 && bestDist > len(s)/3) {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the number of single character insertions, deletions,
+// substitutions and transpositions needed to turn a into b
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, n := range rest {
+		if n < first {
+			first = n
+		}
+	}
+	return first
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+type whichCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"NAME" description:"Path to print: ndk, toolchain, clang, sysroot, isystem, lib, or any binary in the toolchain, e.g. llvm-strip"`
+	} `positional-args:"yes"`
+}
+
+// Execute prints the paths ndkenv builds with, or just the one named
+func (c *whichCommand) Execute([]string) error {
+	t, err := resolve()
+	if err != nil {
+		return err
+	}
+	paths := []struct{ name, path string }{
+		{"ndk", t.ndk},
+		{"toolchain", t.toolchain},
+		{"clang", t.clang},
+		{"sysroot", t.sysroot},
+		{"isystem", t.iSystem},
+		{"lib", t.libDir()},
+	}
+	if c.Args.Name == "" {
+		for _, p := range paths {
+			fmt.Printf("%-10s %s\n", p.name+":", p.path)
+		}
+		return nil
+	}
+	for _, p := range paths {
+		if p.name == c.Args.Name {
+			fmt.Println(p.path)
+			return nil
+		}
+	}
+	tool := t.ndkConfig().Tool(c.Args.Name)
+	if !isFile(tool) {
+		return fmt.Errorf("%s isn't one of ndk, toolchain, clang, sysroot, isystem or lib, or a binary in %s", c.Args.Name, filepath.Dir(tool))
+	}
+	fmt.Println(tool)
+	return nil
+}